@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"math/big"
+	"strings"
+)
+
+const (
+	// addressVersion is the version byte that prefixes every address.
+	addressVersion = 0x00
+	// addressHashSize is the number of bytes of the public key's hash kept in
+	// an address.
+	addressHashSize = 20
+	// addressChecksumSize is the number of checksum bytes at the end of an
+	// address.
+	addressChecksumSize = 4
+)
+
+// base58Alphabet is the Bitcoin base58 alphabet, which leaves out characters
+// that are easily confused with each other.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Address returns the address of the identity's public key. See
+// AddressFromPublicKey.
+func (i Identity) Address() string {
+	return AddressFromPublicKey(i.PublicKey())
+}
+
+// AddressFromPublicKey returns a human-readable address for pub, similar to a
+// Bitcoin address. It's the base58check encoding of a version byte followed
+// by the first 20 bytes of the SHA-256 hash of the key's PKIX form, so typos
+// can be detected with IsValidAddress.
+func AddressFromPublicKey(pub *ecdsa.PublicKey) string {
+	hash := sha256.Sum256(mustBinary(x509.MarshalPKIXPublicKey(pub)))
+	payload := append([]byte{addressVersion}, hash[:addressHashSize]...)
+	return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+// IsValidAddress returns true if address is well-formed and its checksum
+// matches, as for addresses returned by AddressFromPublicKey.
+func IsValidAddress(address string) bool {
+	data, ok := base58Decode(address)
+	if !ok || len(data) != 1+addressHashSize+addressChecksumSize || data[0] != addressVersion {
+		return false
+	}
+	payload, checksum := data[:len(data)-addressChecksumSize], data[len(data)-addressChecksumSize:]
+	return bytes.Equal(checksum, addressChecksum(payload))
+}
+
+// addressChecksum returns the first bytes of the double SHA-256 hash of
+// payload.
+func addressChecksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:addressChecksumSize]
+}
+
+// base58Encode encodes data using base58Alphabet. Each leading zero byte is
+// encoded as a leading '1'.
+func base58Encode(data []byte) string {
+	var out []byte
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(int64(len(base58Alphabet))), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// base58Decode is the inverse of base58Encode. It returns false if s contains
+// characters outside of base58Alphabet.
+func base58Decode(s string) ([]byte, bool) {
+	n := new(big.Int)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, false
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	zeros := len(s) - len(strings.TrimLeft(s, base58Alphabet[:1]))
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
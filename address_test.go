@@ -0,0 +1,36 @@
+package blockchain_test
+
+import (
+	"strings"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestAddress(t *testing.T) {
+	identity := mustIdentity(blockchain.NewIdentity())
+	address := identity.Address()
+	if address != blockchain.AddressFromPublicKey(identity.PublicKey()) {
+		t.Errorf("identity address %s does not match its public key's", address)
+	}
+	if !blockchain.IsValidAddress(address) {
+		t.Fatalf("address %s is not valid", address)
+	}
+
+	for i := range address {
+		replacement := "2"
+		if address[i] == '2' {
+			replacement = "3"
+		}
+		mutated := address[:i] + replacement + address[i+1:]
+		if blockchain.IsValidAddress(mutated) {
+			t.Errorf("address %s mutated at %d is still valid", mutated, i)
+		}
+	}
+
+	for _, invalid := range []string{"", "0OIl", strings.Repeat("1", len(address))} {
+		if blockchain.IsValidAddress(invalid) {
+			t.Errorf("address %q is valid", invalid)
+		}
+	}
+}
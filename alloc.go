@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"slices"
+)
+
+// allocation is a balance credited to a public key by a genesis block.
+type allocation struct {
+	key    *ecdsa.PublicKey
+	amount uint64
+}
+
+// NewChainWithAlloc is like New, but starts the chain with a mined genesis
+// block crediting each public key in alloc with its amount, so that Balance
+// reflects the allocations from height 0. The allocations are committed to by
+// the genesis block's hash.
+func NewChainWithAlloc(difficulty int, alloc map[*ecdsa.PublicKey]uint64) Blockchain {
+	c := New(difficulty)
+	genesis := c.next(nil)
+	for key, amount := range alloc {
+		genesis.alloc = append(genesis.alloc, allocation{key: key, amount: amount})
+	}
+	slices.SortFunc(genesis.alloc, func(a, b allocation) int {
+		return bytes.Compare(mustBinary(x509.MarshalPKIXPublicKey(a.key)), mustBinary(x509.MarshalPKIXPublicKey(b.key)))
+	})
+	// The chain uses proof-of-work, and mining without a deadline can't fail.
+	genesis.Mine(genesis.difficulty)
+	c.push(genesis)
+	return c
+}
+
+// allocHash returns the hash of the block's allocations, which is what the
+// block's header commits to.
+func (b Block) allocHash() []byte {
+	hasher := newHasher(b.newHash)
+	for _, a := range b.alloc {
+		buf := appendBytes(nil, mustBinary(x509.MarshalPKIXPublicKey(a.key)))
+		hasher.Write(binary.BigEndian.AppendUint64(buf, a.amount))
+	}
+	return hasher.Sum(nil)
+}
+
+// allocationsEqual returns true if a and b credit the same amounts to the
+// same keys in the same order.
+func allocationsEqual(a, b allocation) bool {
+	return keysEqual(a.key, b.key) && a.amount == b.amount
+}
@@ -0,0 +1,105 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestNewChainWithAlloc(t *testing.T) {
+	const difficulty = 4
+
+	alice, bob := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	chain := blockchain.NewChainWithAlloc(difficulty, map[*ecdsa.PublicKey]uint64{
+		alice.PublicKey(): 100,
+		bob.PublicKey():   50,
+	})
+	if err := chain.Validate(); err != nil {
+		t.Fatalf("chain is not valid: %s", err)
+	}
+	if chain.Len() != 1 {
+		t.Fatalf("chain has %d blocks, want just the genesis block", chain.Len())
+	}
+
+	block := chain.NewBlock()
+	if err := block.SendTransaction(alice, bob.PublicKey(), []byte("hi")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	tx, err := blockchain.NewValueTransaction(alice, bob.PublicKey(), 30, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := block.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	block.Mine(difficulty)
+
+	for _, c := range []struct {
+		name     string
+		identity blockchain.Identity
+		want     int64
+	}{
+		{"alice", alice, 70},
+		{"bob", bob, 80},
+	} {
+		if got := chain.Balance(c.identity.PublicKey()); got != c.want {
+			t.Errorf("%s: balance = %d, want %d", c.name, got, c.want)
+		}
+		if got := chain.UTXO().Balance(c.identity.PublicKey()); got != c.want {
+			t.Errorf("%s: UTXO balance = %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := chain.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode chain: %s", err)
+	}
+	decoded, err := blockchain.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode chain: %s", err)
+	}
+	if got := decoded.Balance(alice.PublicKey()); got != 70 {
+		t.Errorf("decoded balance = %d, want 70", got)
+	}
+
+	genesis, _ := chain.GetBlock(0)
+	hash := genesis.Hash()
+	genesis.SetAllocation(0, 1000)
+	if bytes.Equal(genesis.Hash(), hash) {
+		t.Error("changing an allocation did not change the genesis hash")
+	}
+	if chain.Valid() {
+		t.Error("chain with a tampered allocation is still valid")
+	}
+}
+
+func TestAppendBlockRejectsAlloc(t *testing.T) {
+	const difficulty = 1
+
+	alice := mustIdentity(blockchain.NewIdentity())
+	source := blockchain.NewChainWithAlloc(difficulty, map[*ecdsa.PublicKey]uint64{alice.PublicKey(): 100})
+	genesis, _ := source.GetBlock(0)
+
+	chain := blockchain.New(difficulty)
+	if err := chain.AppendBlock(genesis.Clone()); err != nil {
+		t.Fatalf("failed to append genesis block: %s", err)
+	}
+
+	// A later block carrying the same allocation would credit it again.
+	block := genesis.Clone()
+	block.SetPrevHash(genesis.Hash())
+	block.SetTimestamp(time.Now())
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != blockchain.ErrUnexpectedAlloc {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrUnexpectedAlloc)
+	}
+	if chain.Len() != 1 {
+		t.Error("block with an allocation was appended")
+	}
+	if got := chain.Balance(alice.PublicKey()); got != 100 {
+		t.Errorf("balance = %d, want 100", got)
+	}
+}
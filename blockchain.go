@@ -4,230 +4,1711 @@ package blockchain
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
+	"hash"
+	"iter"
+	"maps"
 	"math/big"
+	mathbits "math/bits"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-// Blockchain represents the blockchain.
+// Blockchain represents the blockchain. Its methods are safe for concurrent
+// use, but blocks returned from it are not; don't modify a block once it's
+// been shared with other goroutines.
 type Blockchain struct {
+	// mu guards l. Exported methods take the lock and then only call
+	// unexported ones, which assume it is held.
+	mu          *sync.RWMutex
 	l           *list.List
 	difficulty  int
 	proofPrefix string
+	target      *big.Int
+
+	// targetInterval and window configure difficulty retargeting, which is
+	// disabled if either is zero.
+	targetInterval time.Duration
+	window         int
+
+	// maxTxPerBlock limits the number of transactions in each block, or is
+	// zero if there is no limit.
+	maxTxPerBlock int
+
+	// maxBlockSize limits the size of each block as reported by Block.Size,
+	// or is zero if there is no limit.
+	maxBlockSize int
+
+	// requireData rejects transactions with no data from the chain's blocks.
+	requireData bool
+
+	// allowedSenders holds the hex-encoded public keys allowed to send
+	// transactions on the chain, as returned by Transaction.Sender, or is
+	// empty if anyone may.
+	allowedSenders map[string]struct{}
+
+	// maxFutureDrift limits how far ahead of now a block's timestamp may be,
+	// or is zero if there is no limit.
+	maxFutureDrift time.Duration
+
+	// now returns the current time.
+	now func() time.Time
+
+	// curve is used for identities created with NewIdentity.
+	curve elliptic.Curve
+
+	// utxo holds the balances of the chain's blocks. See UTXO.
+	utxo *UTXOSet
+
+	// newHash constructs the hash function used for blocks and transactions
+	// on the chain, or is nil to use SHA-256.
+	newHash func() hash.Hash
+
+	// consensus proves and validates the chain's blocks.
+	consensus Consensus
+
+	// subs receives each block pushed onto the chain. See Subscribe.
+	subs *subscribers
+
+	// index locates the chain's transactions. See FindTransaction.
+	index *txIndex
 }
 
 // New constructs a new Blockchain with the provided mining difficulty.
 func New(difficulty int) Blockchain {
-	return Blockchain{
-		l:           list.New(),
-		difficulty:  difficulty,
-		proofPrefix: strings.Repeat("0", difficulty),
-	}
+	return NewChain(WithDifficulty(difficulty))
+}
+
+// NewWithTarget constructs a new Blockchain that starts at initialDifficulty
+// and retargets it after every block, aiming for one block every target. The
+// time taken by the last window blocks is compared against the target, and
+// the difficulty is raised or lowered by one if blocks are coming too fast or
+// too slow.
+func NewWithTarget(initialDifficulty int, target time.Duration, window int) Blockchain {
+	return NewChain(WithDifficulty(initialDifficulty), WithTargetInterval(target), WithRetargetWindow(window))
+}
+
+// NewWithLimit is like New, but limits each block on the chain to at most
+// maxTxPerBlock transactions. A limit of zero means unlimited.
+func NewWithLimit(difficulty, maxTxPerBlock int) Blockchain {
+	return NewChain(WithDifficulty(difficulty), WithMaxTxPerBlock(maxTxPerBlock))
 }
 
-// Add adds a new block to the chain, returning a reference to it.
+// NewChainWithHasher is like New, but hashes blocks and transactions using
+// the hash function returned by newHash instead of SHA-256.
+func NewChainWithHasher(difficulty int, newHash func() hash.Hash) Blockchain {
+	return NewChain(WithDifficulty(difficulty), WithHasher(newHash))
+}
+
+// NewBlock adds a new block to the chain, returning a reference to it.
 func (c Blockchain) NewBlock() *Block {
-	const initialNonce = 0
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	block := c.next(nil)
+	c.push(block)
+	return block
+}
+
+// Add creates a new block holding data on top of the chain, proves it under
+// the chain's consensus, such as by mining it, and appends it, returning a
+// reference to it. If the block can't be proven, such as under proof-of-stake
+// when its proposer isn't one of the signers, nothing is appended and Add
+// returns nil.
+func (c *Blockchain) Add(data []byte) *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	block := c.next(data)
+	if err := c.consensus.ProveBlock(block); err != nil {
+		return nil
+	}
+	c.push(block)
+	c.index.update(*c)
+	return block
+}
+
+// Genesis creates the first block on the chain holding data, proves it under
+// the chain's consensus, and appends it. It returns an error if the chain
+// already has blocks or the block can't be proven.
+func (c *Blockchain) Genesis(data []byte) (*Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.l.Len() > 0 {
+		return nil, errors.New("blockchain.Genesis: chain already has a genesis block")
+	}
+	block := c.next(data)
+	if err := c.consensus.ProveBlock(block); err != nil {
+		return nil, errors.New("blockchain.Genesis: " + err.Error())
+	}
+	c.push(block)
+	c.index.update(*c)
+	return block, nil
+}
+
+// Errors returned by AppendBlock.
+var (
+	ErrPrevHashMismatch     = errors.New("blockchain: block does not build on the chain's tip")
+	ErrInsufficientWork     = errors.New("blockchain: block does not have sufficient proof-of-work")
+	ErrInvalidSignature     = errors.New("blockchain: block contains a transaction with an invalid signature")
+	ErrTooManyTransactions  = errors.New("blockchain: block contains too many transactions")
+	ErrDuplicateTransaction = errors.New("blockchain: block contains a transaction already on the chain")
+	ErrBlockTooLarge        = errors.New("blockchain: block is larger than the chain allows")
+	ErrTimestampTooEarly    = errors.New("blockchain: block's timestamp is before the chain's tip")
+	ErrTimestampTooLate     = errors.New("blockchain: block's timestamp is too far in the future")
+	ErrSenderNotAllowed     = errors.New("blockchain: block contains a transaction from a sender the chain doesn't allow")
+	ErrUnsortedTransactions = errors.New("blockchain: block's transactions are not sorted by hash")
+	ErrUnexpectedAlloc      = errors.New("blockchain: only the genesis block may allocate balances")
+)
+
+// AppendBlock appends an already-mined block, such as one received from a
+// peer, to the chain. The block must build on the current tip, allocate no
+// balances unless it's the genesis block, be at least at the chain's next
+// difficulty and proven under the chain's consensus, contain only signed
+// transactions, sorted by hash, that aren't already on the chain and are from
+// senders the chain allows, respect the chain's transaction and size limits,
+// and be timestamped no earlier than the tip and no further in the future
+// than the chain allows; otherwise one of ErrPrevHashMismatch,
+// ErrUnexpectedAlloc, ErrInsufficientWork, ErrInvalidSignature,
+// ErrUnsortedTransactions, ErrDuplicateTransaction, ErrSenderNotAllowed,
+// ErrTooManyTransactions, ErrBlockTooLarge, ErrTimestampTooEarly, or
+// ErrTimestampTooLate is returned.
+func (c *Blockchain) AppendBlock(b *Block) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxTxPerBlock > 0 && len(b.transactions) > c.maxTxPerBlock {
+		return ErrTooManyTransactions
+	}
+	if c.maxBlockSize > 0 && b.Size() > c.maxBlockSize {
+		return ErrBlockTooLarge
+	}
+	var (
+		tip     *Block
+		tipHash []byte
+	)
+	if back := c.l.Back(); back != nil {
+		tip = back.Value.(*Block)
+		tipHash = tip.Hash()
+	}
+	if !bytes.Equal(b.prevHash, tipHash) {
+		return ErrPrevHashMismatch
+	}
+	if tip != nil && len(b.alloc) > 0 {
+		return ErrUnexpectedAlloc
+	}
+	if tip != nil && b.timestamp.Before(tip.timestamp) {
+		return ErrTimestampTooEarly
+	}
+	if c.tooFarAhead(b.timestamp) {
+		return ErrTimestampTooLate
+	}
+
+	// Check the block as hashed by the chain's hash function, only adopting
+	// it once the block is known to be valid.
+	candidate := *b
+	candidate.transactions = append([]Transaction(nil), b.transactions...)
+	candidate.setHasher(c.newHash)
+	if candidate.difficulty < c.nextDifficulty() || !c.consensus.ValidateBlock(&candidate) {
+		return ErrInsufficientWork
+	}
+	for _, t := range candidate.transactions {
+		if !t.Verify() {
+			return ErrInvalidSignature
+		}
+		if !senderAllowed(c.allowedSenders, t) {
+			return ErrSenderNotAllowed
+		}
+	}
+	if !candidate.transactionsSorted() {
+		return ErrUnsortedTransactions
+	}
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		for _, t := range candidate.transactions {
+			if e.Value.(*Block).ContainsTransaction(t.Hash()) {
+				return ErrDuplicateTransaction
+			}
+		}
+	}
+	b.setHasher(c.newHash)
+	c.push(b)
+	c.updateUTXO()
+	c.index.update(*c)
+	return nil
+}
+
+// push appends block to the end of the chain, recording its height, and
+// publishes it to the chain's subscribers.
+func (c Blockchain) push(block *Block) {
+	block.height = c.l.Len()
+	c.l.PushBack(block)
+	c.subs.publish(block)
+}
 
+// next returns a new block holding data that builds on the current tip of
+// the chain, without adding it.
+func (c Blockchain) next(data []byte) *Block {
 	var prevHash []byte
 	if prevBlock := c.l.Back(); prevBlock != nil {
 		prevHash = prevBlock.Value.(*Block).Hash()
 	}
-	block := &Block{
-		prevHash:    prevHash,
-		timestamp:   time.Now(),
-		nonce:       initialNonce,
-		difficulty:  c.difficulty,
-		proofPrefix: c.proofPrefix,
+	block := NewBlock(prevHash, data)
+	block.timestamp = c.now()
+	block.now = c.now
+	block.difficulty = c.nextDifficulty()
+	block.maxTransactions = c.maxTxPerBlock
+	block.maxSize = c.maxBlockSize
+	block.requireData = c.requireData
+	block.allowedSenders = c.allowedSenders
+	block.newHash = c.newHash
+	return block
+}
+
+// NextDifficulty returns the difficulty required of the next block added to
+// the chain. Without retargeting, this is always the chain's difficulty.
+func (c Blockchain) NextDifficulty() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.nextDifficulty()
+}
+
+func (c Blockchain) nextDifficulty() int {
+	difficulty := c.difficulty
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		difficulty = c.retarget(e, difficulty)
+	}
+	return difficulty
+}
+
+// retarget returns the difficulty required of the block following e, given
+// the difficulty that was required of e.
+func (c Blockchain) retarget(e *list.Element, difficulty int) int {
+	if c.targetInterval <= 0 || c.window <= 0 {
+		return difficulty
+	}
+
+	first := e
+	for i := 0; i < c.window; i++ {
+		if first = first.Prev(); first == nil {
+			return difficulty
+		}
+	}
+
+	actual := e.Value.(*Block).timestamp.Sub(first.Value.(*Block).timestamp)
+	expected := c.targetInterval * time.Duration(c.window)
+	switch {
+	case actual < expected:
+		return difficulty + 1
+	case actual > expected && difficulty > 0:
+		return difficulty - 1
+	}
+	return difficulty
+}
+
+// Len returns the length of the blockchain.
+func (c Blockchain) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.l.Len()
+}
+
+// GetBlock returns the block at the given zero-based height, where the
+// genesis block is at height 0.
+func (c Blockchain) GetBlock(index int) (*Block, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if index < 0 || index >= c.l.Len() {
+		return nil, errors.New("blockchain.GetBlock: index " + strconv.Itoa(index) + " out of range")
+	}
+	e := c.l.Front()
+	for i := 0; i < index; i++ {
+		e = e.Next()
+	}
+	return e.Value.(*Block), nil
+}
+
+// GetBlockByHash returns the block whose hex-encoded hash is hexHash, and
+// whether one was found. It walks the whole chain, so callers looking up the
+// same hashes repeatedly may want to cache the results.
+func (c Blockchain) GetBlockByHash(hexHash string) (*Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		if block := e.Value.(*Block); block.HashString() == hexHash {
+			return block, true
+		}
+	}
+	return nil, false
+}
+
+// Tip returns the most recently added block, or false if the chain is empty.
+func (c Blockchain) Tip() (*Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	back := c.l.Back()
+	if back == nil {
+		return nil, false
+	}
+	return back.Value.(*Block), true
+}
+
+// WorkProven returns true if the provided hex-encoded hash counts as valid
+// proof-of-work at the chain's difficulty.
+func (c Blockchain) WorkProven(hash string) bool {
+	return WorkProvenAt(hash, c.difficulty)
+}
+
+// WorkProvenAt returns true if the provided hex-encoded hash counts as valid
+// proof-of-work at the given difficulty, independent of any chain.
+func WorkProvenAt(hash string, difficulty int) bool {
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	return WorkProvenBits(raw, difficulty)
+}
+
+// WorkProvenBits returns true if the raw hash begins with at least the given
+// number of zero bits, which is what a difficulty counts.
+func WorkProvenBits(hash []byte, bits int) bool {
+	for _, b := range hash {
+		if bits <= 0 {
+			return true
+		}
+		if bits < 8 {
+			return mathbits.LeadingZeros8(b) >= bits
+		}
+		if b != 0 {
+			return false
+		}
+		bits -= 8
+	}
+	return bits <= 0
+}
+
+// VerifyBlockPoW returns true if b was mined to at least the given difficulty,
+// independent of any chain, meaning that it commits to a difficulty at least
+// that high and its hash counts as proof-of-work at it. Only the proof-of-work
+// is checked; the block's transactions and linkage aren't.
+func VerifyBlockPoW(b *Block, difficulty int) bool {
+	if b == nil || b.difficulty < difficulty {
+		return false
+	}
+	return WorkProvenBits(b.Hash(), difficulty)
+}
+
+// Valid checks if this blockchain is valid. See Validate for the rules a
+// valid blockchain must follow.
+func (c Blockchain) Valid() bool {
+	return c.Validate() == nil
+}
+
+// ValidationError describes the first rule a chain broke during validation.
+// Rule names the rule, which is one of:
+//
+//	proof         the block isn't proven under the chain's consensus
+//	transactions  the block holds more transactions than the chain allows
+//	size          the block is larger than the chain allows
+//	signature     a transaction isn't signed by its sender
+//	duplicate     a transaction already appears in an earlier block
+//	linkage       the block's previous hash is wrong
+//	timestamp     the block's timestamp is out of range
+//	alloc         a block other than the genesis block allocates balances
+//	checkpoint    the block doesn't match a checkpoint
+//	hash          the block's hash doesn't match the one it was mined with
+//	order         the block's transactions aren't sorted by hash
+type ValidationError struct {
+	Height int
+	Rule   string
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return "block " + strconv.Itoa(e.Height) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// invalid returns a *ValidationError for the block at the given height.
+func invalid(height int, rule, msg string) error {
+	return &ValidationError{Height: height, Rule: rule, Err: errors.New(msg)}
+}
+
+// Validate checks if this blockchain is valid, returning an error describing
+// the first rule that was broken if not. For a blockchain to be valid, each
+// block must be at least at the difficulty required at its height and be
+// proven under the chain's consensus, the first block must have an empty
+// previous hash and every other block's must match the hash of the block
+// before it, only the first block may allocate balances, no block's timestamp
+// may be before the previous block's or further ahead of the current time
+// than the chain allows, every transaction must be signed by its sender and
+// appear in only one block, each block's transactions must be sorted by hash,
+// and no block may hold more transactions or be larger than the chain allows.
+//
+// The error is a *ValidationError. Its Rule is never "checkpoint" or "hash",
+// which are only checked by ValidateFromCheckpoint and VerifyStored.
+func (c Blockchain) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.validateFrom(0)
+}
+
+// ValidateFrom is like Validate, but only validates blocks from the given height
+// onwards, which is useful when the blocks before it are already known to be
+// valid. The first block checked is still required to link to the block
+// immediately before it. If validation fails, the returned error identifies
+// the height of the first invalid block.
+func (c Blockchain) ValidateFrom(index int) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if index < 0 || index > c.l.Len() {
+		return false, errors.New("blockchain.ValidateFrom: index " + strconv.Itoa(index) + " out of range")
+	}
+	if err := c.validateFrom(index); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// validateFrom validates every block at or above the given height.
+func (c Blockchain) validateFrom(index int) error {
+	difficulty := c.difficulty
+	height := 0
+	// seen maps the hash of every transaction so far to the height of the
+	// block it's in, so that a transaction can't be replayed in a later block.
+	seen := make(map[string]int)
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		if height >= index {
+			if err := c.validateBlock(e, height, difficulty); err != nil {
+				return err
+			}
+		}
+		for i, t := range e.Value.(*Block).transactions {
+			hash := string(t.Hash())
+			if first, ok := seen[hash]; ok && height >= index {
+				return invalid(height, "duplicate", "transaction "+strconv.Itoa(i)+" already appears in block "+strconv.Itoa(first))
+			}
+			seen[hash] = height
+		}
+		difficulty = c.retarget(e, difficulty)
+		height++
+	}
+	return nil
+}
+
+// validateBlock validates a single block at the given height, which must
+// meet the given difficulty.
+func (c Blockchain) validateBlock(e *list.Element, height, difficulty int) error {
+	currBlock := e.Value.(*Block)
+	if currBlock.difficulty < difficulty || !c.consensus.ValidateBlock(currBlock) {
+		return invalid(height, "proof", proofFailure(c.consensus))
+	}
+
+	if c.maxTxPerBlock > 0 && len(currBlock.transactions) > c.maxTxPerBlock {
+		return invalid(height, "transactions", "too many transactions")
+	}
+
+	if c.maxBlockSize > 0 && currBlock.Size() > c.maxBlockSize {
+		return invalid(height, "size", "block too large")
+	}
+
+	for i, t := range currBlock.transactions {
+		if !t.Verify() {
+			return invalid(height, "signature", "transaction "+strconv.Itoa(i)+" has an invalid signature")
+		}
+	}
+
+	if !currBlock.transactionsSorted() {
+		return invalid(height, "order", "transactions are not sorted by hash")
+	}
+
+	if prev := e.Prev(); prev != nil {
+		prevBlock := prev.Value.(*Block)
+
+		if !bytes.Equal(prevBlock.Hash(), currBlock.prevHash) {
+			return invalid(height, "linkage", "prevHash mismatch")
+		}
+
+		if currBlock.timestamp.Before(prevBlock.timestamp) {
+			return invalid(height, "timestamp", "timestamp is before the previous block's")
+		}
+	} else if len(currBlock.prevHash) > 0 {
+		return invalid(height, "linkage", "genesis block has a non-empty prevHash")
+	}
+
+	if height > 0 && len(currBlock.alloc) > 0 {
+		return invalid(height, "alloc", "only the genesis block may allocate balances")
+	}
+
+	if c.tooFarAhead(currBlock.timestamp) {
+		return invalid(height, "timestamp", "timestamp is too far in the future")
+	}
+
+	return nil
+}
+
+// tooFarAhead returns true if timestamp is further ahead of the chain's clock
+// than its maximum future drift allows.
+func (c Blockchain) tooFarAhead(timestamp time.Time) bool {
+	return c.maxFutureDrift > 0 && timestamp.After(c.now().Add(c.maxFutureDrift))
+}
+
+// Balance returns the total amount received by pub, plus any fees collected
+// from mining and any balance allocated to it by the genesis block, minus the
+// total amount and fees it has sent, across every transaction on the chain.
+func (c Blockchain) Balance(pub *ecdsa.PublicKey) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var balance int64
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		block := e.Value.(*Block)
+		if block.miner != nil && block.miner.Equal(pub) {
+			balance += int64(block.TotalFees())
+		}
+		for _, a := range block.alloc {
+			if a.key.Equal(pub) {
+				balance += int64(a.amount)
+			}
+		}
+		for _, t := range block.transactions {
+			for _, o := range t.Outputs() {
+				if o.Receiver.Equal(pub) {
+					balance += int64(o.Amount)
+				}
+			}
+			if keysEqual(t.sender, pub) {
+				balance -= int64(t.amount + t.fee)
+			}
+		}
+	}
+	return balance
+}
+
+// HasTransaction returns true if a transaction with the given hash appears in
+// any block on the chain.
+func (c Blockchain) HasTransaction(hash []byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Block).ContainsTransaction(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune replaces every block but the last keepLast with a stub that only
+// keeps its hash, previous hash, timestamp, nonce, difficulty, miner, and
+// proof, which is enough for the chain to still validate. Pruned blocks have
+// no data, metadata, allocations, or transactions, so they no longer count
+// towards Balance and their transactions can't be found with FindTransaction,
+// though the chain's UTXO set is unaffected.
+func (c *Blockchain) Prune(keepLast int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if keepLast < 0 {
+		return errors.New("blockchain.Prune: keepLast must not be negative")
+	}
+	c.updateUTXO()
+	e := c.l.Front()
+	for i := 0; i < c.l.Len()-keepLast; i++ {
+		if block := e.Value.(*Block); !block.Pruned() {
+			e.Value = &Block{
+				prevHash:   block.prevHash,
+				timestamp:  block.timestamp,
+				nonce:      block.nonce,
+				difficulty: block.difficulty,
+				miner:      block.miner,
+				proof:      block.proof,
+				height:     block.height,
+				newHash:    block.newHash,
+				prunedHash: block.Hash(),
+			}
+		}
+		e = e.Next()
+	}
+	c.index.reset()
+	c.index.update(*c)
+	return nil
+}
+
+// String returns a readable version of the chain: a header line with its
+// length and difficulty, followed by each of its blocks.
+func (c Blockchain) String() string {
+	blocks := c.blocks()
+	var buf bytes.Buffer
+	buf.WriteString("blockchain of " + strconv.Itoa(len(blocks)) + " blocks at difficulty " + strconv.Itoa(c.difficulty) + "\n\n")
+	for _, block := range blocks {
+		buf.WriteString(block.String())
+	}
+	return buf.String()
+}
+
+// Clone returns a deep copy of the chain, so that its blocks can be modified
+// without affecting the original. The copy starts without any subscribers.
+func (c Blockchain) Clone() Blockchain {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	clone := c
+	clone.mu = new(sync.RWMutex)
+	clone.l = list.New()
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		clone.l.PushBack(e.Value.(*Block).Clone())
+	}
+	clone.utxo = c.utxo.clone()
+	clone.subs = newSubscribers()
+	clone.index = newTxIndex()
+	return clone
+}
+
+// ForEach calls f once with each block on the chain. The blocks are
+// collected up front, so f may safely call back into the chain, but blocks
+// added during iteration won't be visited.
+func (c Blockchain) ForEach(f func(*Block)) {
+	for _, block := range c.blocks() {
+		f(block)
+	}
+}
+
+// ForEachUntil is like ForEach, but stops as soon as f returns false.
+func (c Blockchain) ForEachUntil(f func(*Block) bool) {
+	for _, block := range c.blocks() {
+		if !f(block) {
+			return
+		}
+	}
+}
+
+// ForEachTransaction calls f once with each transaction on the chain, along
+// with the block it's in, visiting blocks front to back. Like ForEach, it
+// iterates over a snapshot of the chain.
+func (c Blockchain) ForEachTransaction(f func(block *Block, t Transaction)) {
+	for _, block := range c.blocks() {
+		for _, t := range block.transactions {
+			f(block, t)
+		}
+	}
+}
+
+// Blocks returns an iterator over the blocks on the chain, front to back. Like
+// ForEach, it iterates over a snapshot of the chain taken when iteration
+// starts.
+func (c Blockchain) Blocks() iter.Seq[*Block] {
+	return func(yield func(*Block) bool) {
+		c.ForEachUntil(yield)
+	}
+}
+
+// blocks returns a snapshot of the blocks on the chain, front to back.
+func (c Blockchain) blocks() []*Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	blocks := make([]*Block, 0, c.l.Len())
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		blocks = append(blocks, e.Value.(*Block))
+	}
+	return blocks
+}
+
+// Block represents a single piece of data in the blockchain.
+type Block struct {
+	prevHash     []byte
+	timestamp    time.Time
+	nonce        uint32
+	data         []byte
+	transactions []Transaction
+	miner        *ecdsa.PublicKey
+	difficulty   int
+	height       int
+
+	// merkleRoot is the Merkle root of the block's transactions at the time
+	// it was mined, or nil if it hasn't been.
+	merkleRoot []byte
+
+	// cachedHash is the block's hash as of when it was last mined, or nil if
+	// it hasn't been or anything the hash covers has changed since. Every
+	// method that changes the block must clear it.
+	cachedHash []byte
+
+	// storedHash is the hash the block was mined with as read back by Decode
+	// or ReadFrom, or nil if it wasn't stored with one. It's never trusted as
+	// the block's hash, only checked against it by VerifyStored.
+	storedHash []byte
+
+	// maxTransactions is the transaction limit of the chain the block was
+	// created for, or zero if there is no limit.
+	maxTransactions int
+
+	// maxSize is the size limit of the chain the block was created for, or
+	// zero if there is no limit.
+	maxSize int
+
+	// requireData is true if the chain the block was created for rejects
+	// transactions with no data.
+	requireData bool
+
+	// allowedSenders holds the senders allowed by the chain the block was
+	// created for, or is empty if anyone may send transactions.
+	allowedSenders map[string]struct{}
+
+	// newHash is the hash function of the chain the block was created for,
+	// or nil for SHA-256. It's shared with the block's transactions.
+	newHash func() hash.Hash
+
+	// now is the clock of the chain the block was created for, or nil to use
+	// time.Now. It's used to timestamp transactions sent with the block.
+	now func() time.Time
+
+	// meta holds arbitrary metadata committed to by the block's hash.
+	meta map[string]string
+
+	// prunedHash is the hash of the block before it was pruned, or nil if it
+	// hasn't been. Pruned blocks only keep what's needed to link the chain.
+	prunedHash []byte
+
+	// proof is the proposer's signature over the block's hash under
+	// proof-of-stake consensus, or nil otherwise. It isn't covered by the
+	// hash.
+	proof []byte
+
+	// alloc holds the balances credited by a genesis block created with
+	// NewChainWithAlloc, sorted by key.
+	alloc []allocation
+}
+
+// NewBlock constructs a standalone block holding data that refers to the block
+// with hash prevHash. Its difficulty is zero until it is mined.
+func NewBlock(prevHash []byte, data []byte) *Block {
+	const initialNonce = 0
+
+	return &Block{
+		prevHash:  prevHash,
+		timestamp: time.Now(),
+		nonce:     initialNonce,
+		data:      data,
+	}
+}
+
+// NewBlockForMiner is like NewBlock, but credits miner with the fees paid by
+// the block's transactions.
+func NewBlockForMiner(prevHash []byte, miner *ecdsa.PublicKey, data []byte) *Block {
+	block := NewBlock(prevHash, data)
+	block.miner = miner
+	return block
+}
+
+// Clone returns a deep copy of the block, including its transactions.
+func (b Block) Clone() *Block {
+	clone := b
+	clone.prevHash = cloneBytes(b.prevHash)
+	clone.data = cloneBytes(b.data)
+	clone.merkleRoot = cloneBytes(b.merkleRoot)
+	clone.cachedHash = cloneBytes(b.cachedHash)
+	clone.storedHash = cloneBytes(b.storedHash)
+	clone.meta = maps.Clone(b.meta)
+	clone.prunedHash = cloneBytes(b.prunedHash)
+	clone.proof = cloneBytes(b.proof)
+	clone.alloc = slices.Clone(b.alloc)
+	clone.transactions = nil
+	for _, t := range b.transactions {
+		clone.transactions = append(clone.transactions, t.clone())
+	}
+	return &clone
+}
+
+// Equal returns true if other has the same contents as b: the same previous
+// hash, timestamp, nonce, difficulty, data, metadata, miner, proof,
+// allocations, and transactions in the same order.
+func (b Block) Equal(other *Block) bool {
+	if other == nil {
+		return false
+	}
+	return bytes.Equal(b.prevHash, other.prevHash) &&
+		b.timestamp.Equal(other.timestamp) &&
+		b.nonce == other.nonce &&
+		b.difficulty == other.difficulty &&
+		bytes.Equal(b.data, other.data) &&
+		maps.Equal(b.meta, other.meta) &&
+		keysEqual(b.miner, other.miner) &&
+		bytes.Equal(b.proof, other.proof) &&
+		slices.EqualFunc(b.alloc, other.alloc, allocationsEqual) &&
+		slices.EqualFunc(b.transactions, other.transactions, Transaction.Equal)
+}
+
+// String returns a readable version of this block, including all of its
+// transactions.
+func (b Block) String() string {
+	const idSize = 6
+
+	hashString := b.HashString()
+	var buf bytes.Buffer
+	buf.WriteString("block " + hashString + "\n")
+	buf.WriteString(strings.Repeat("=", len("block "+hashString)) + "\n")
+	if len(b.data) > 0 {
+		buf.Write(b.data)
+		buf.WriteString("\n")
+	}
+	for _, transaction := range b.transactions {
+		from, to := transaction.Sender(), transaction.Receiver()
+		shortFrom := from[:idSize] + "..." + from[len(from)-idSize:]
+		shortTo := to[:idSize] + "..." + to[len(to)-idSize:]
+		buf.WriteString(shortFrom + " -> " + shortTo + ": ")
+		buf.Write(transaction.data)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// SendTransaction sends a message transaction holding data from the identity
+// "from" to the public key "to".  The transaction is automatically signed,
+// returning an error if signing fails.
+func (b *Block) SendTransaction(from Identity, to *ecdsa.PublicKey, data []byte) error {
+	t, err := newTransaction("blockchain.SendTransaction", from, Transaction{
+		kind:      TxMessage,
+		receiver:  to,
+		data:      data,
+		timestamp: b.clock(),
+		newHash:   b.newHash,
+	})
+	if err != nil {
+		return err
+	}
+	return b.AddTransaction(t)
+}
+
+// AddTransaction adds an already-signed transaction to the block, returning
+// an error if its signature can't be verified, if it's already in the block,
+// if the block is full, either by number of transactions or by size, if it
+// has no data and the block's chain requires it, or if its sender isn't
+// allowed by the block's chain. The transaction's hash is made with the
+// block's hash function, but its signature doesn't depend on it. Transactions
+// are kept sorted by hash, so that the block's Merkle root doesn't depend on
+// the order they were added in.
+func (b *Block) AddTransaction(t Transaction) error {
+	t.newHash = b.newHash
+	if !t.Verify() {
+		return errors.New("blockchain.Block.AddTransaction: transaction is not signed by its sender")
+	}
+	if b.requireData && len(t.data) == 0 {
+		return errors.New("blockchain.Block.AddTransaction: transaction has no data")
+	}
+	if !senderAllowed(b.allowedSenders, t) {
+		return errors.New("blockchain.Block.AddTransaction: transaction sender is not allowed")
+	}
+	if b.maxTransactions > 0 && len(b.transactions) >= b.maxTransactions {
+		return errBlockFull
+	}
+	if b.maxSize > 0 && b.Size()+t.size() > b.maxSize {
+		return errBlockTooLarge
+	}
+	hash := t.Hash()
+	i, found := slices.BinarySearchFunc(b.transactions, hash, func(other Transaction, hash []byte) int {
+		return bytes.Compare(other.Hash(), hash)
+	})
+	if found {
+		return errors.New("blockchain.Block.AddTransaction: duplicate transaction")
+	}
+	b.transactions = slices.Insert(b.transactions, i, t)
+	b.cachedHash = nil
+	return nil
+}
+
+// Errors returned by AddTransaction when the block has no room for a
+// transaction, which might still fit in another block.
+var (
+	errBlockFull     = errors.New("blockchain.Block.AddTransaction: block is full")
+	errBlockTooLarge = errors.New("blockchain.Block.AddTransaction: block would exceed its maximum size")
+)
+
+// transactionsSorted returns true if the block's transactions are sorted by
+// hash, as AddTransaction keeps them.
+func (b Block) transactionsSorted() bool {
+	for i := 1; i < len(b.transactions); i++ {
+		if bytes.Compare(b.transactions[i-1].Hash(), b.transactions[i].Hash()) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the size of the block in bytes, which is the length of its
+// previous hash plus its timestamp and nonce, plus the binary encoding of each
+// of its transactions.
+func (b Block) Size() int {
+	const timestampSize, nonceSize = 8, 4
+
+	size := len(b.prevHash) + timestampSize + nonceSize
+	for _, t := range b.transactions {
+		size += t.size()
+	}
+	return size
+}
+
+// hashVersion identifies the scheme used by Block.Hash. It must be bumped
+// whenever the hash changes, since blocks hashed under an older scheme will no
+// longer validate.
+//
+// Version 2 added the block's difficulty to the hash, so that a block can't
+// be replayed into a chain expecting a higher difficulty.
+//
+// Version 3 replaced time.Time's binary encoding of the timestamp with its
+// Unix time in nanoseconds, which doesn't depend on the Go version or the
+// timestamp's location.
+//
+// Version 4 reinterpreted the difficulty committed to by the hash as a number
+// of leading zero bits rather than leading zero hex digits.
+//
+// Version 5 added a timestamp to each transaction's hash, which changes the
+// Merkle root of any block with transactions.
+//
+// Version 6 added the block's metadata to the hash.
+//
+// Version 7 added the kind of each transaction to its hash.
+//
+// Version 8 removed the sender from each transaction's hash, so that the
+// sender can be recovered from the transaction's signature.
+//
+// Version 9 committed to the block's data and metadata through their own
+// hashes, so that a block's hash can be computed from its header alone.
+//
+// Version 10 added the balances allocated by a genesis block to the hash.
+//
+// Version 11 split each transaction's hash from the hash its sender signs,
+// making it cover the sender and signature, which changes the Merkle root of
+// any block with transactions. The signing hash always uses SHA-256.
+const hashVersion = 11
+
+// Hash calculates the block's hash. It uses the previous block's hash along
+// with this block's timestamp, nonce, difficulty, the hashes of its data,
+// metadata, and allocations, its miner, and the Merkle root of its
+// transactions, all of which are in its header. For a pruned block, it's the
+// hash the block had before it was pruned.
+//
+// Mining caches the hash, so that hashing a mined block is cheap until it's
+// changed again. The cache is only kept up to date by the block's methods, so
+// a block's transactions mustn't be modified through the slice returned by
+// Transactions.
+func (b Block) Hash() []byte {
+	if b.prunedHash == nil && b.cachedHash != nil {
+		return cloneBytes(b.cachedHash)
+	}
+	return b.Header().Hash()
+}
+
+// HashString returns the hex-encoded result of Hash().
+func (b Block) HashString() string {
+	return hex.EncodeToString(b.Hash())
+}
+
+// PrevHash returns the hash of the previous block, which is empty for the
+// genesis block.
+func (b Block) PrevHash() []byte {
+	return b.prevHash
+}
+
+// Timestamp returns the block's timestamp in UTC.
+func (b Block) Timestamp() time.Time {
+	return b.timestamp.UTC()
+}
+
+// Height returns the block's zero-based position in the chain it was added
+// to. Blocks that were never added to a chain report 0.
+func (b Block) Height() int {
+	return b.height
+}
+
+// SetMeta sets the metadata stored under key. Metadata is committed to by the
+// block's hash, so it must be set before the block is mined.
+func (b *Block) SetMeta(key, value string) {
+	if b.meta == nil {
+		b.meta = make(map[string]string)
+	}
+	b.meta[key] = value
+	b.cachedHash = nil
+}
+
+// Meta returns the metadata stored under key, or false if there is none.
+func (b Block) Meta(key string) (string, bool) {
+	value, ok := b.meta[key]
+	return value, ok
+}
+
+// clock returns the current time according to the block's clock.
+func (b Block) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// Pruned returns true if the block has been pruned by Blockchain.Prune.
+func (b Block) Pruned() bool {
+	return b.prunedHash != nil
+}
+
+// Nonce returns the nonce found by mining the block.
+func (b Block) Nonce() uint32 {
+	return b.nonce
+}
+
+// Difficulty returns the difficulty the block was mined at.
+func (b Block) Difficulty() int {
+	return b.difficulty
+}
+
+// Miner returns the public key credited with this block's fees, or nil if
+// there isn't one.
+func (b Block) Miner() *ecdsa.PublicKey {
+	return b.miner
+}
+
+// TotalFees returns the sum of the fees paid by the block's transactions.
+func (b Block) TotalFees() uint64 {
+	var total uint64
+	for _, t := range b.transactions {
+		total += t.fee
+	}
+	return total
+}
+
+// Data returns the block's data.
+func (b Block) Data() []byte {
+	return b.data
+}
+
+// Transactions returns the block's transactions.
+func (b Block) Transactions() []Transaction {
+	return b.transactions
+}
+
+// ContainsTransaction returns true if the block includes a transaction with
+// the given hash.
+func (b Block) ContainsTransaction(hash []byte) bool {
+	for _, t := range b.transactions {
+		if bytes.Equal(t.Hash(), hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllTransactions returns an iterator over the block's transactions and their
+// indices.
+func (b Block) AllTransactions() iter.Seq2[int, Transaction] {
+	return func(yield func(int, Transaction) bool) {
+		for i, t := range b.transactions {
+			if !yield(i, t) {
+				return
+			}
+		}
+	}
+}
+
+// Mine attempts to make this block valid at the given difficulty by searching
+// for a nonce value that will qualify as proof-of-work, meaning the block's
+// hash is below the target for that difficulty. Once it succeeds, it returns
+// the resulting hex-encoded hash. Negative difficulties are treated
+// as zero.
+//
+// The block's current nonce is tried first, so mining a block again at a
+// difficulty it already meets returns immediately without changing it. The
+// hash commits to the difficulty, though, so a block mined at one difficulty
+// is unlikely to still meet a higher one without further work.
+func (b *Block) Mine(difficulty int) string {
+	if difficulty < 0 {
+		difficulty = 0
+	}
+	if difficulty != b.difficulty {
+		b.difficulty = difficulty
+		b.cachedHash = nil
 	}
-	c.l.PushBack(block)
-	return block
+	hash, _ := b.MineContext(context.Background())
+	return hash
 }
 
-// Len returns the length of the blockchain.
-func (c Blockchain) Len() int {
-	return c.l.Len()
+// MineContext is like Mine at the block's current difficulty, but gives up
+// and returns ctx.Err() if the context is cancelled before a valid nonce is
+// found. The context is checked every mineCheckInterval attempts.
+func (b *Block) MineContext(ctx context.Context) (string, error) {
+	hash, _, err := b.mine(ctx, 0, nil)
+	return hash, err
 }
 
-// WorkProven returns true if the provided hex-encoded hash counts as valid
-// proof-of-work.
-func (c Blockchain) WorkProven(hash string) bool {
-	return strings.HasPrefix(hash, c.proofPrefix)
+// MineUntil is like Mine at the block's current difficulty, but gives up once
+// the deadline passes. The boolean result reports whether a valid nonce was
+// found in time.
+func (b *Block) MineUntil(deadline time.Time) (string, bool) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	hash, err := b.MineContext(ctx)
+	return hash, err == nil
 }
 
-// Valid checks if this blockchain is valid. For a blockchain to be valid,
-// each block must have valid proof-of-work, and each previous hash reference
-// must match that of the previous block.
-func (c Blockchain) Valid() bool {
-	for e := c.l.Front(); e != nil; e = e.Next() {
-		currBlock := e.Value.(*Block)
-		if !c.WorkProven(currBlock.HashString()) {
-			return false
-		}
+// ErrMiningExhausted is returned by MineBounded when it runs out of attempts.
+var ErrMiningExhausted = errors.New("blockchain: mining attempts exhausted without finding a valid nonce")
 
-		if prev := e.Prev(); prev != nil {
-			prevBlock := prev.Value.(*Block)
+// MineBounded is like Mine at the block's current difficulty, but gives up and
+// returns ErrMiningExhausted after maxAttempts hashes without success.
+func (b *Block) MineBounded(maxAttempts uint64) (string, error) {
+	hash, _, err := b.mine(context.Background(), maxAttempts, nil)
+	return hash, err
+}
 
-			if !bytes.Equal(prevBlock.Hash(), currBlock.prevHash) {
-				return false
-			}
+// MineRange is like Mine at the block's current difficulty, but only tries
+// the nonces in [start, end), so that the search can be split among workers
+// that each mine their own copy of the block. It returns the resulting
+// hex-encoded hash and true if one of them is valid, or false with the nonce
+// left as it was otherwise. Unlike Mine, it never wraps around, so the block's
+// timestamp is left alone.
+func (b *Block) MineRange(start, end uint32) (string, bool) {
+	b.commitMerkleRoot()
+	target := difficultyTarget(b.difficulty)
+	original := b.nonce
+	for nonce := uint64(start); nonce < uint64(end); nonce++ {
+		if uint32(nonce) != b.nonce {
+			b.nonce = uint32(nonce)
+			b.cachedHash = nil
+		}
+		if hash := b.Hash(); meetsTarget(hash, target) {
+			b.cachedHash = hash
+			return hex.EncodeToString(hash), true
 		}
 	}
-
-	return true
+	if b.nonce != original {
+		b.nonce = original
+		b.cachedHash = nil
+	}
+	return "", false
 }
 
-// ForEach calls f once with each block on the chain.
-func (c Blockchain) ForEach(f func(*Block)) {
-	for e := c.l.Front(); e != nil; e = e.Next() {
-		block := e.Value.(*Block)
-		f(block)
-	}
+// MineWithProgress is like Mine at the block's current difficulty, but calls
+// report with the running number of attempts every mineReportInterval
+// attempts, which is useful for showing progress at high difficulties.
+func (b *Block) MineWithProgress(report func(attempts uint64)) string {
+	hash, _, _ := b.mine(context.Background(), 0, report)
+	return hash
 }
 
-// Block represents a single piece of data in the blockchain.
-type Block struct {
-	prevHash     []byte
-	timestamp    time.Time
-	nonce        uint32
-	transactions []Transaction
-	difficulty   int
-	proofPrefix  string
+// MineStats describes the work done to mine a block.
+type MineStats struct {
+	// Attempts is the number of hashes computed, including the successful one.
+	Attempts uint64
+	// Duration is the time spent from the first attempt to the successful one.
+	Duration time.Duration
+	// HashesPerSec is the average hash rate over Duration.
+	HashesPerSec float64
 }
 
-// String returns a readable version of this block, including all of its
-// transactions.
-func (b Block) String() string {
-	const idSize = 6
+// MineWithStats is like Mine at the block's current difficulty, but also
+// reports how much work it took.
+func (b *Block) MineWithStats() (hash string, stats MineStats) {
+	start := time.Now()
+	hash, stats.Attempts, _ = b.mine(context.Background(), 0, nil)
+	stats.Duration = time.Since(start)
+	if stats.Duration > 0 {
+		stats.HashesPerSec = float64(stats.Attempts) / stats.Duration.Seconds()
+	}
+	return hash, stats
+}
 
-	hashString := b.HashString()
-	var buf bytes.Buffer
-	buf.WriteString("block " + hashString + "\n")
-	buf.WriteString(strings.Repeat("=", len("block "+hashString)) + "\n")
-	for _, transaction := range b.transactions {
-		from, to := transaction.Sender(), transaction.Receiver()
-		shortFrom := from[:idSize] + "..." + from[len(from)-idSize:]
-		shortTo := to[:idSize] + "..." + to[len(to)-idSize:]
-		buf.WriteString(shortFrom + " -> " + shortTo + ": ")
-		buf.Write(transaction.data)
-		buf.WriteString("\n")
+// mine searches for a valid nonce at the block's current difficulty, returning
+// the resulting hash and the number of attempts it took. It gives up if ctx
+// is cancelled or, unless maxAttempts is zero, after maxAttempts attempts. If
+// report is non-nil, it is called every mineReportInterval attempts.
+//
+// If the nonce wraps around without success, the timestamp is nudged forward
+// so that the search can continue over hashes that haven't been tried yet.
+func (b *Block) mine(ctx context.Context, maxAttempts uint64, report func(uint64)) (string, uint64, error) {
+	b.commitMerkleRoot()
+	target := difficultyTarget(b.difficulty)
+	for attempts := uint64(0); ; attempts++ {
+		if attempts%mineCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", attempts, err
+			}
+		}
+		if maxAttempts > 0 && attempts == maxAttempts {
+			return "", attempts, ErrMiningExhausted
+		}
+		hash := b.Hash()
+		if report != nil && (attempts+1)%mineReportInterval == 0 {
+			report(attempts + 1)
+		}
+		if meetsTarget(hash, target) {
+			b.cachedHash = hash
+			return hex.EncodeToString(hash), attempts + 1, nil
+		}
+		if b.nonce++; b.nonce == 0 {
+			b.timestamp = b.timestamp.Add(time.Nanosecond)
+		}
+		b.cachedHash = nil
 	}
-	buf.WriteString("\n")
-	return buf.String()
 }
 
-// SendTransaction sends a transaction from the identity "from" to the public
-// key "to".  The transaction is automatically signed, returning an error if
-// signing fails.
-func (b *Block) SendTransaction(from Identity, to *ecdsa.PublicKey, data []byte) error {
-	random := make([]byte, 4)
-	if _, err := rand.Read(random); err != nil {
-		return err
+// MineParallel is like Mine at the block's current difficulty, but splits the
+// search across the given number of worker goroutines. Each worker starts at a
+// different offset and strides by the number of workers, hashing its own copy
+// of the block; the winning nonce is written back once one of them succeeds.
+// Like Mine, the search continues past the last nonce by nudging the timestamp
+// forward, along with the nonce if it won.
+func (b *Block) MineParallel(workers int) string {
+	if workers < 1 {
+		workers = 1
 	}
-	t := Transaction{
-		sender:   &from.signer.PublicKey,
-		receiver: to,
-		data:     data,
-		random:   random,
+	b.commitMerkleRoot()
+	target := difficultyTarget(b.difficulty)
+
+	// Each worker counts through the nonces as the low 32 bits of a 64-bit
+	// counter whose high bits are how many nanoseconds to add to the
+	// timestamp, so that the workers never try the same hash twice.
+	type result struct {
+		nonce     uint32
+		timestamp time.Time
 	}
-	if err := t.Sign(from); err != nil {
-		return errors.New("blockchain.SendTransaction: failed to sign transaction: " + err.Error())
+	var (
+		found     = make(chan result, workers)
+		done      = make(chan struct{})
+		wg        sync.WaitGroup
+		start     = uint64(b.nonce)
+		timestamp = b.timestamp
+	)
+	for i := 0; i < workers; i++ {
+		local := *b
+		local.cachedHash = nil
+		wg.Add(1)
+		go func(next uint64) {
+			defer wg.Done()
+			for attempts := 0; ; attempts++ {
+				if attempts%mineCheckInterval == 0 {
+					select {
+					case <-done:
+						return
+					default:
+					}
+				}
+				local.nonce = uint32(next)
+				local.timestamp = timestamp.Add(time.Duration(next >> 32))
+				if meetsTarget(local.Hash(), target) {
+					found <- result{nonce: local.nonce, timestamp: local.timestamp}
+					return
+				}
+				next += uint64(workers)
+			}
+		}(start + uint64(i))
 	}
-	b.transactions = append(b.transactions, t)
-	return nil
+
+	won := <-found
+	b.nonce, b.timestamp = won.nonce, won.timestamp
+	close(done)
+	wg.Wait()
+	b.cachedHash = b.Header().Hash()
+	return hex.EncodeToString(b.cachedHash)
 }
 
-// Hash calculates the block's hash. It uses the previous block's hash along
-// with this block's timestamp, nonce, and data.
-func (b Block) Hash() []byte {
-	v := make([]byte, 4)
-	binary.LittleEndian.PutUint32(v, b.nonce)
-
-	hasher := sha256.New()
-	hasher.Write(b.prevHash)
-	hasher.Write(mustBinary(b.timestamp.MarshalBinary()))
-	hasher.Write(v)
-	// NOTE: this part may need to be reworked, e.g. to use a merkle tree
-	for _, t := range b.transactions {
-		hasher.Write(t.Hash())
+// setHasher sets the hash function used for the block and its transactions.
+func (b *Block) setHasher(newHash func() hash.Hash) {
+	b.newHash = newHash
+	b.cachedHash = nil
+	for i := range b.transactions {
+		b.transactions[i].newHash = newHash
 	}
-	return hasher.Sum(nil)
 }
 
-// HashString returns the hex-encoded result of Hash().
-func (b Block) HashString() string {
-	return hex.EncodeToString(b.Hash())
+// commitMerkleRoot records the block's current Merkle root, so that
+// VerifyTransactions can detect transactions being changed after mining.
+func (b *Block) commitMerkleRoot() {
+	b.merkleRoot = append([]byte{}, b.MerkleRoot()...)
 }
 
-// Timestamp returns the block's timestamp.
-func (b Block) Timestamp() time.Time {
-	return b.timestamp
+// VerifyTransactions checks that every transaction in the block is signed by
+// its sender and, if the block has been mined, that the transactions still
+// match the Merkle root committed to when it was mined.
+func (b Block) VerifyTransactions() error {
+	for i, t := range b.transactions {
+		if !t.Verify() {
+			return errors.New("blockchain.Block.VerifyTransactions: transaction " + strconv.Itoa(i) + " has an invalid signature")
+		}
+	}
+	if b.merkleRoot != nil && !bytes.Equal(b.merkleRoot, b.MerkleRoot()) {
+		return errors.New("blockchain.Block.VerifyTransactions: transactions do not match the Merkle root committed when mining")
+	}
+	return nil
 }
 
-// Data returns the block's transactions.
-func (b Block) Transactions() []Transaction {
-	return b.transactions
-}
+// mineCheckInterval is the number of nonce attempts between checks for
+// cancellation while mining.
+const mineCheckInterval = 4096
 
-// Mine attempts to make this block valid by searching for a nonce value that
-// will qualify as proof-of-work. Once it succeeds, it returns the resulting
-// hex-encoded hash.
-func (b *Block) Mine() string {
-	for !strings.HasPrefix(b.HashString(), b.proofPrefix) {
-		b.nonce++
-	}
-	return b.HashString()
-}
+// mineReportInterval is the number of nonce attempts between calls to the
+// report function passed to MineWithProgress.
+const mineReportInterval = 1024
 
 // Identity represents a user of the blockchain. It's analogous to bitcoin's
-// wallet in that it is used to sign messages.
+// wallet in that it is used to sign messages, which it does through a Signer.
 type Identity struct {
-	signer *ecdsa.PrivateKey
+	signer Signer
 }
 
 // NewIdentity constructs a new identity. In doing so it generates a new
-// private/public key pair.
+// private/public key pair on the P-224 curve.
 func NewIdentity() (Identity, error) {
-	// No idea which elliptic curve is best here.
-	privateKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	return NewIdentityWithCurve(elliptic.P224())
+}
+
+// NewIdentityWithCurve is like NewIdentity, but generates the key pair on the
+// given curve. Any of the standard NIST curves may be used.
+func NewIdentityWithCurve(curve elliptic.Curve) (Identity, error) {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return Identity{}, errors.New("blockchain.NewIdentity: " + err.Error())
 	}
 
 	return Identity{
-		signer: privateKey,
+		signer: keySigner{key: privateKey},
 	}, nil
 }
 
 // PublicKey returns the public key associated with this identity.
 func (i Identity) PublicKey() *ecdsa.PublicKey {
-	return &i.signer.PublicKey
+	return i.signer.Public()
+}
+
+// Sign signs an arbitrary message with the identity's private key. The
+// message is hashed with SHA-256 before signing.
+func (i Identity) Sign(message []byte) (r, s *big.Int, err error) {
+	digest := sha256.Sum256(message)
+	r, s, err = i.signer.Sign(digest[:])
+	if err != nil {
+		return nil, nil, errors.New("blockchain.Identity.Sign: " + err.Error())
+	}
+	return r, s, nil
+}
+
+// VerifySignature returns true if r and s are a valid signature of message by
+// the owner of pub, as produced by Identity.Sign.
+func VerifySignature(pub *ecdsa.PublicKey, message []byte, r, s *big.Int) bool {
+	if pub == nil || r == nil || s == nil {
+		return false
+	}
+	digest := sha256.Sum256(message)
+	return ecdsa.Verify(pub, digest[:], r, s)
+}
+
+// SignAll signs every transaction in txs that the identity is the sender of.
+// The rest are left untouched, and if there are any, the returned error lists
+// their indices.
+func (i Identity) SignAll(txs []*Transaction) error {
+	var skipped, failed []string
+	for n, t := range txs {
+		if !t.sentBy(i) {
+			skipped = append(skipped, strconv.Itoa(n))
+			continue
+		}
+		if err := t.Sign(i); err != nil {
+			failed = append(failed, strconv.Itoa(n)+" ("+err.Error()+")")
+		}
+	}
+	var problems []string
+	if len(skipped) > 0 {
+		problems = append(problems, "not the sender of transactions "+strings.Join(skipped, ", "))
+	}
+	if len(failed) > 0 {
+		problems = append(problems, "failed to sign transactions "+strings.Join(failed, ", "))
+	}
+	if len(problems) > 0 {
+		return errors.New("blockchain.Identity.SignAll: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ExportPEM returns the identity's private key as a PEM block of type
+// "EC PRIVATE KEY", suitable for saving to disk. It returns an error for an
+// identity created with NewIdentityFromSigner.
+func (i Identity) ExportPEM() ([]byte, error) {
+	key, ok := i.privateKey()
+	if !ok {
+		return nil, errors.New("blockchain.Identity.ExportPEM: private key is only available to the identity's signer")
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, errors.New("blockchain.Identity.ExportPEM: " + err.Error())
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+}
+
+// ImportIdentityPEM parses an identity previously exported with ExportPEM.
+func ImportIdentityPEM(data []byte) (Identity, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Identity{}, errors.New("blockchain.ImportIdentityPEM: no PEM block found")
+	}
+	if block.Type != pemType {
+		return Identity{}, errors.New("blockchain.ImportIdentityPEM: unexpected PEM block type " + block.Type)
+	}
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return Identity{}, errors.New("blockchain.ImportIdentityPEM: " + err.Error())
+	}
+	return Identity{
+		signer: keySigner{key: privateKey},
+	}, nil
+}
+
+// pemType is the PEM block type used for exported identities.
+const pemType = "EC PRIVATE KEY"
+
+// TxKind identifies what a transaction is for.
+type TxKind uint8
+
+const (
+	// TxTransfer transactions transfer value from the sender to the receiver.
+	TxTransfer TxKind = iota
+	// TxMessage transactions carry a message in their data.
+	TxMessage
+	// TxContract transactions call a contract owned by the receiver, with the
+	// call encoded in their data.
+	TxContract
+)
+
+// String returns the name of the kind.
+func (k TxKind) String() string {
+	switch k {
+	case TxTransfer:
+		return "transfer"
+	case TxMessage:
+		return "message"
+	case TxContract:
+		return "contract"
+	}
+	return "TxKind(" + strconv.Itoa(int(k)) + ")"
 }
 
 // Transaction represents a signed message on the blockchain.
 type Transaction struct {
+	kind             TxKind
 	sender, receiver *ecdsa.PublicKey
+	amount, fee      uint64
+	timestamp        time.Time
 	// random is a random sequence of bytes intended to reduce the chances of hash collisions
 	data, random []byte
 	sig1, sig2   *big.Int
+	// outputs holds the payments made by a transaction with multiple
+	// recipients, or is nil for any other. See NewMultiTransaction.
+	outputs []Output
+	// recoveryID identifies the sender among the public keys the signature
+	// could have been made by; see RecoverPublicKey.
+	recoveryID byte
+
+	// newHash is the hash function used for the transaction's hash, or nil
+	// for SHA-256. Its signing hash always uses SHA-256.
+	newHash func() hash.Hash
+}
+
+// NewValueTransaction constructs a transaction transferring amount from the
+// identity "from" to the public key "to", along with some arbitrary data. The
+// transaction is automatically signed, returning an error if signing fails.
+func NewValueTransaction(from Identity, to *ecdsa.PublicKey, amount uint64, data []byte) (Transaction, error) {
+	return newTransaction("blockchain.NewValueTransaction", from, Transaction{kind: TxTransfer, receiver: to, amount: amount, data: data})
+}
+
+// NewFeeTransaction is like NewValueTransaction, but also pays fee to the
+// miner of the block the transaction ends up in.
+func NewFeeTransaction(from Identity, to *ecdsa.PublicKey, amount, fee uint64, data []byte) (Transaction, error) {
+	return newTransaction("blockchain.NewFeeTransaction", from, Transaction{kind: TxTransfer, receiver: to, amount: amount, fee: fee, data: data})
+}
+
+// NewMessageTransaction constructs a signed transaction sending a message
+// from the identity "from" to the public key "to", without transferring any
+// value.
+func NewMessageTransaction(from Identity, to *ecdsa.PublicKey, message []byte) (Transaction, error) {
+	return newTransaction("blockchain.NewMessageTransaction", from, Transaction{kind: TxMessage, receiver: to, data: message})
+}
+
+// NewContractTransaction constructs a signed transaction calling the contract
+// owned by the public key "to" with the given call data, transferring amount
+// to it.
+func NewContractTransaction(from Identity, to *ecdsa.PublicKey, amount uint64, call []byte) (Transaction, error) {
+	return newTransaction("blockchain.NewContractTransaction", from, Transaction{kind: TxContract, receiver: to, amount: amount, data: call})
+}
+
+// newTransaction completes t as a transaction sent by from and signs it. The
+// timestamp is set to the current time unless t already has one. Errors are
+// prefixed by prefix, the name of the calling function.
+func newTransaction(prefix string, from Identity, t Transaction) (Transaction, error) {
+	t.random = make([]byte, 4)
+	if _, err := rand.Read(t.random); err != nil {
+		return Transaction{}, errors.New(prefix + ": " + err.Error())
+	}
+	t.sender = from.PublicKey()
+	if t.timestamp.IsZero() {
+		t.timestamp = time.Now()
+	}
+	if err := t.Sign(from); err != nil {
+		return Transaction{}, errors.New(prefix + ": failed to sign transaction: " + err.Error())
+	}
+	return t, nil
+}
+
+// clone returns a deep copy of the transaction. Public keys are shared, since
+// they're never modified.
+func (t Transaction) clone() Transaction {
+	clone := t
+	clone.data = cloneBytes(t.data)
+	clone.random = cloneBytes(t.random)
+	clone.outputs = slices.Clone(t.outputs)
+	if t.sig1 != nil {
+		clone.sig1 = new(big.Int).Set(t.sig1)
+	}
+	if t.sig2 != nil {
+		clone.sig2 = new(big.Int).Set(t.sig2)
+	}
+	return clone
+}
+
+// Equal returns true if other has the same contents as t: the same kind,
+// sender, receiver, amount, fee, timestamp, data, random bytes, and signature.
+func (t Transaction) Equal(other Transaction) bool {
+	return t.kind == other.kind &&
+		keysEqual(t.sender, other.sender) &&
+		keysEqual(t.receiver, other.receiver) &&
+		t.amount == other.amount &&
+		t.fee == other.fee &&
+		t.timestamp.Equal(other.timestamp) &&
+		bytes.Equal(t.data, other.data) &&
+		bytes.Equal(t.random, other.random) &&
+		slices.EqualFunc(t.outputs, other.outputs, outputsEqual) &&
+		intsEqual(t.sig1, other.sig1) &&
+		intsEqual(t.sig2, other.sig2)
 }
 
-// Hash returns this transaction's hash, which serves as an identifier.
+// Hash returns this transaction's hash, which serves as its identifier. It
+// covers everything the signing hash does along with the sender and
+// signature, so that two transactions with the same hash are the same
+// transaction from the same sender, and it changes when the transaction is
+// signed. It's made with the hash function of the chain the transaction was
+// added to. It panics if a public key can't be marshaled, which can't happen
+// for a transaction that was successfully signed; use HashErr otherwise.
 func (t Transaction) Hash() []byte {
-	hasher := sha256.New()
-	hasher.Write(mustBinary(x509.MarshalPKIXPublicKey(t.sender)))
-	hasher.Write(mustBinary(x509.MarshalPKIXPublicKey(t.receiver)))
-	hasher.Write(t.data)
-	hasher.Write(t.random)
-	return hasher.Sum(nil)
+	return mustBinary(t.HashErr())
+}
+
+// HashErr is like Hash, but returns an error instead of panicking if a public
+// key can't be marshaled.
+func (t Transaction) HashErr() ([]byte, error) {
+	signed, err := t.signedBytes()
+	if err != nil {
+		return nil, errors.New("blockchain.Transaction.Hash: " + err.Error())
+	}
+	var sender []byte
+	if t.sender != nil {
+		if sender, err = x509.MarshalPKIXPublicKey(t.sender); err != nil {
+			return nil, errors.New("blockchain.Transaction.Hash: invalid sender: " + err.Error())
+		}
+	}
+
+	hasher := newHasher(t.newHash)
+	hasher.Write(signed)
+	hasher.Write(appendBytes(nil, sender))
+	hasher.Write(appendBytes(nil, intBytes(t.sig1)))
+	hasher.Write(appendBytes(nil, intBytes(t.sig2)))
+	hasher.Write([]byte{t.recoveryID})
+	return hasher.Sum(nil), nil
+}
+
+// SigningHash returns the hash the transaction's sender signs, which covers
+// everything but the sender and signature, so that the sender can be
+// recovered from the signature with RecoverPublicKey. Signatures made
+// elsewhere and attached with SetSignature must be over this hash. It's
+// always made with SHA-256, whatever the hash function of the chain, so that a
+// transaction can be signed before it's known which chain it will be added
+// to. Like Hash, it panics if the receiver's public key can't be marshaled.
+func (t Transaction) SigningHash() []byte {
+	return mustBinary(t.signingHash())
+}
+
+// signingHash is like SigningHash, but returns an error instead of panicking.
+func (t Transaction) signingHash() ([]byte, error) {
+	signed, err := t.signedBytes()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(signed)
+	return hash[:], nil
+}
+
+// signedBytes returns the parts of the transaction covered by its signature,
+// which are hashed into both its signing hash and its hash.
+func (t Transaction) signedBytes() ([]byte, error) {
+	receiver, err := x509.MarshalPKIXPublicKey(t.receiver)
+	if err != nil {
+		return nil, errors.New("invalid receiver: " + err.Error())
+	}
+
+	buf := append([]byte(nil), receiver...)
+	buf = binary.LittleEndian.AppendUint64(buf, t.amount)
+	buf = binary.LittleEndian.AppendUint64(buf, t.fee)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(t.timestamp.UnixNano()))
+	buf = append(buf, byte(t.kind))
+	buf = append(buf, t.data...)
+	buf = append(buf, t.random...)
+	return t.appendOutputs(buf, binary.LittleEndian)
+}
+
+// size returns the length of the transaction's binary encoding.
+func (t Transaction) size() int {
+	return len(mustBinary(t.MarshalBinary()))
+}
+
+// Kind returns the kind of the transaction.
+func (t Transaction) Kind() TxKind {
+	return t.kind
+}
+
+// Amount returns the value transferred by this transaction, which is zero
+// for transactions that only carry data.
+func (t Transaction) Amount() uint64 {
+	return t.amount
+}
+
+// Fee returns the fee this transaction pays to the miner of its block.
+func (t Transaction) Fee() uint64 {
+	return t.fee
+}
+
+// Timestamp returns the time at which the transaction was created.
+func (t Transaction) Timestamp() time.Time {
+	return t.timestamp.UTC()
 }
 
 // Data returns the underlying data of this transaction.
@@ -235,39 +1716,278 @@ func (t Transaction) Data() []byte {
 	return t.data
 }
 
-// Sender returns a hex-encoded version of the sender's public key.
+// Sender returns a hex-encoded version of the sender's public key. Like Hash,
+// it panics if the key can't be marshaled; use SenderErr otherwise.
 func (t Transaction) Sender() string {
-	return hex.EncodeToString(mustBinary(x509.MarshalPKIXPublicKey(t.sender)))
+	return mustString(t.SenderErr())
+}
+
+// SenderErr is like Sender, but returns an error instead of panicking.
+func (t Transaction) SenderErr() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(t.sender)
+	if err != nil {
+		return "", errors.New("blockchain.Transaction.Sender: " + err.Error())
+	}
+	return hex.EncodeToString(der), nil
 }
 
-// Receiver returns a hex-encoded version of the receiver's public key.
+// Receiver returns a hex-encoded version of the receiver's public key. Like
+// Hash, it panics if the key can't be marshaled; use ReceiverErr otherwise.
 func (t Transaction) Receiver() string {
-	return hex.EncodeToString(mustBinary(x509.MarshalPKIXPublicKey(t.receiver)))
+	return mustString(t.ReceiverErr())
+}
+
+// ReceiverErr is like Receiver, but returns an error instead of panicking.
+func (t Transaction) ReceiverErr() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(t.receiver)
+	if err != nil {
+		return "", errors.New("blockchain.Transaction.Receiver: " + err.Error())
+	}
+	return hex.EncodeToString(der), nil
 }
 
 // Sign signs the transaction using the given identity. It must be equal to the
 // sender of the message, but for security reasons we don't want to save the
-// private key within the transaction itself.
+// private key within the transaction itself. Only about half of all signatures
+// are canonical, as Verify requires, so the identity's signer is asked again
+// until it produces one, and Sign gives up with an error after maxSignAttempts.
 func (t *Transaction) Sign(identity Identity) error {
-	if !bytes.Equal(mustBinary(x509.MarshalPKIXPublicKey(identity.PublicKey())), mustBinary(x509.MarshalPKIXPublicKey(t.sender))) {
+	if !t.sentBy(identity) {
 		return errors.New("can't sign transaction unless you're the sender")
 	}
 
-	r, s, err := ecdsa.Sign(rand.Reader, identity.signer, t.Hash())
+	hash, err := t.signingHash()
 	if err != nil {
 		return errors.New("blockchain.Transaction.Sign: " + err.Error())
 	}
-	t.sig1, t.sig2 = r, s
+	for attempt := 0; attempt < maxSignAttempts; attempt++ {
+		r, s, err := identity.signer.Sign(hash)
+		if err != nil {
+			return errors.New("blockchain.Transaction.Sign: " + err.Error())
+		}
+		s = lowS(t.sender.Curve, s)
+		if id, ok := canonicalRecoveryID(t.sender, hash, r, s); ok {
+			t.sig1, t.sig2, t.recoveryID = r, s, id
+			return nil
+		}
+	}
+	return errors.New("blockchain.Transaction.Sign: signer did not produce a canonical signature")
+}
+
+// maxSignAttempts is how many signatures Sign asks for before giving up on
+// getting a canonical one. Each is canonical with a probability of about one
+// half, so a signer that signs with random nonces virtually never runs out.
+const maxSignAttempts = 64
+
+// SignDeterministic is like Sign, but produces a deterministic signature as
+// described in RFC 6979, so signing the same transaction with the same
+// identity always yields the same signature. It needs the identity's private
+// key, so it returns an error for an identity created with
+// NewIdentityFromSigner.
+func (t *Transaction) SignDeterministic(identity Identity) error {
+	if !t.sentBy(identity) {
+		return errors.New("can't sign transaction unless you're the sender")
+	}
+
+	hash, err := t.signingHash()
+	if err != nil {
+		return errors.New("blockchain.Transaction.SignDeterministic: " + err.Error())
+	}
+	key, ok := identity.privateKey()
+	if !ok {
+		return errors.New("blockchain.Transaction.SignDeterministic: private key is only available to the identity's signer")
+	}
+	canonical := func(r, s *big.Int) bool {
+		_, ok := canonicalRecoveryID(t.sender, hash, r, lowS(t.sender.Curve, s))
+		return ok
+	}
+	r, s, err := signRFC6979(key, hash, canonical)
+	if err != nil {
+		return errors.New("blockchain.Transaction.SignDeterministic: " + err.Error())
+	}
+	t.sig1, t.sig2 = r, lowS(t.sender.Curve, s)
+	t.recoveryID, _ = canonicalRecoveryID(t.sender, hash, t.sig1, t.sig2)
+	return nil
+}
+
+// Signature returns copies of the two components of the transaction's
+// signature, or false if it hasn't been signed.
+func (t Transaction) Signature() (r, s *big.Int, ok bool) {
+	if t.sig1 == nil || t.sig2 == nil {
+		return nil, nil, false
+	}
+	return new(big.Int).Set(t.sig1), new(big.Int).Set(t.sig2), true
+}
+
+// SetSignature attaches a signature made elsewhere over the transaction's
+// signing hash. The signature isn't checked; use Verify for that, but if s is
+// in the upper half of the curve's order, it's replaced by its equally valid
+// counterpart in the lower half, which is the only one Verify accepts. Verify
+// also rejects a signature whose recovery id is odd, which happens for about
+// half of all signatures; the transaction must then be signed again.
+func (t *Transaction) SetSignature(r, s *big.Int) {
+	t.sig1, t.sig2 = nil, nil
+	if r != nil {
+		t.sig1 = new(big.Int).Set(r)
+	}
+	if s != nil {
+		t.sig2 = new(big.Int).Set(s)
+	}
+	t.findRecoveryID()
+}
+
+// SignatureDER returns the transaction's signature as an ASN.1 DER encoded
+// SEQUENCE of its two components, as used by OpenSSL and crypto/ecdsa.
+func (t Transaction) SignatureDER() ([]byte, error) {
+	if t.sig1 == nil || t.sig2 == nil {
+		return nil, errors.New("blockchain.Transaction.SignatureDER: transaction is not signed")
+	}
+	der, err := asn1.Marshal(ecdsaSignature{R: t.sig1, S: t.sig2})
+	if err != nil {
+		return nil, errors.New("blockchain.Transaction.SignatureDER: " + err.Error())
+	}
+	return der, nil
+}
+
+// SetSignatureDER is like SetSignature, but parses the signature from the
+// form returned by SignatureDER.
+func (t *Transaction) SetSignatureDER(der []byte) error {
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return errors.New("blockchain.Transaction.SetSignatureDER: " + err.Error())
+	}
+	if len(rest) > 0 {
+		return errors.New("blockchain.Transaction.SetSignatureDER: trailing data")
+	}
+	t.sig1, t.sig2 = sig.R, sig.S
+	t.findRecoveryID()
 	return nil
 }
 
+// findRecoveryID puts the transaction's signature in canonical form and sets
+// the recovery id to match it and the sender, if it can.
+func (t *Transaction) findRecoveryID() {
+	t.recoveryID = 0
+	if t.sig1 == nil || t.sig2 == nil || !validKey(t.sender) {
+		return
+	}
+	t.sig2 = lowS(t.sender.Curve, t.sig2)
+	if hash, err := t.signingHash(); err == nil {
+		t.recoveryID, _ = recoveryIDFor(t.sender, hash, t.sig1, t.sig2)
+	}
+}
+
+// RecoveryID returns the recovery id of the transaction's signature, which
+// with RecoverPublicKey identifies the sender.
+func (t Transaction) RecoveryID() byte {
+	return t.recoveryID
+}
+
+// recoverSender recovers the sender's public key from the transaction's
+// signature. The sender is assumed to use the same curve as the receiver.
+func (t Transaction) recoverSender() (*ecdsa.PublicKey, error) {
+	if t.receiver == nil {
+		return nil, errors.New("transaction has no receiver")
+	}
+	hash, err := t.signingHash()
+	if err != nil {
+		return nil, err
+	}
+	return recoverPublicKey(t.receiver.Curve, hash, t.sig1, t.sig2, t.recoveryID)
+}
+
+// senderRecoverable returns true if the sender can be recovered from the
+// transaction's signature, and so can be left out when it's encoded.
+func (t Transaction) senderRecoverable() bool {
+	sender, err := t.recoverSender()
+	return err == nil && keysEqual(sender, t.sender)
+}
+
+// sentBy returns true if identity is the sender of the transaction.
+func (t Transaction) sentBy(identity Identity) bool {
+	return identity.PublicKey().Equal(t.sender)
+}
+
+// ecdsaSignature is the ASN.1 structure of an ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
 // Signed returns true if the transaction was signed and could be verified,
-// otherwise false.
+// otherwise false. It is equivalent to Verify.
 func (t *Transaction) Signed() bool {
-	if t.sig1 == nil || t.sig2 == nil {
+	return t.Verify()
+}
+
+// Verify returns true if the transaction carries a valid signature from its
+// sender, otherwise false. It's false if the sender is missing, as it is for a
+// decoded transaction whose sender couldn't be recovered from its signature,
+// or isn't a point on its curve, and for a signature whose s is in the upper
+// half of the curve's order, which Sign and SetSignature never produce. The
+// recovery id must also be even and be the one that recovers the sender, or
+// zero if none does. It's covered by the hash, and otherwise flipping it would
+// give a transaction with a new hash, from whichever key it then recovers, that
+// still verifies.
+func (t Transaction) Verify() bool {
+	if t.sig1 == nil || t.sig2 == nil || !validKey(t.sender) {
+		return false
+	}
+	hash, err := t.signingHash()
+	if err != nil {
+		return false
+	}
+	if !ecdsa.Verify(t.sender, hash, t.sig1, t.sig2) {
 		return false
 	}
-	return ecdsa.Verify(t.sender, t.Hash(), t.sig1, t.sig2)
+	id, ok := canonicalRecoveryID(t.sender, hash, t.sig1, t.sig2)
+	return ok && t.recoveryID == id
+}
+
+// validKey returns true if pub is a point on its curve.
+func validKey(pub *ecdsa.PublicKey) bool {
+	return pub != nil && pub.Curve != nil && pub.X != nil && pub.Y != nil && pub.Curve.IsOnCurve(pub.X, pub.Y)
+}
+
+// newHasher returns a new hash.Hash from newHash, or a SHA-256 one if newHash
+// is nil.
+func newHasher(newHash func() hash.Hash) hash.Hash {
+	if newHash == nil {
+		return sha256.New()
+	}
+	return newHash()
+}
+
+// proofPrefix returns the prefix every hex-encoded hash that counts as
+// proof-of-work at the given difficulty starts with. Since each hex digit
+// covers four bits, it's only a sufficient condition when the difficulty is a
+// multiple of four.
+func proofPrefix(difficulty int) string {
+	return strings.Repeat("0", difficulty/4)
+}
+
+// keysEqual returns true if a and b are both nil or are equal keys.
+func keysEqual(a, b *ecdsa.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b)
+}
+
+// intsEqual returns true if a and b are both nil or have the same value.
+func intsEqual(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+// cloneBytes returns a copy of b, preserving nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
 }
 
 func mustBinary(b []byte, err error) []byte {
@@ -276,3 +1996,10 @@ func mustBinary(b []byte, err error) []byte {
 	}
 	return b
 }
+
+func mustString(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
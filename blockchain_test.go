@@ -1,7 +1,23 @@
 package blockchain_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	blockchain "github.com/dradtke/go-blockchain"
 )
@@ -16,13 +32,13 @@ func TestBlockchain(t *testing.T) {
 	if err := block.SendTransaction(me, you.PublicKey(), []byte("why hello there!")); err != nil {
 		t.Fatalf("failed to send transaction: %s", err)
 	}
-	block.Mine()
+	block.Mine(difficulty)
 
 	block = chain.NewBlock()
 	if err := block.SendTransaction(you, me.PublicKey(), []byte("and hello to you too!")); err != nil {
 		t.Fatalf("failed to send transaction: %s", err)
 	}
-	block.Mine()
+	block.Mine(difficulty)
 
 	if !chain.Valid() {
 		t.Error("blockchain is not valid")
@@ -42,6 +58,1779 @@ func TestEmptyBlockchain(t *testing.T) {
 	}
 }
 
+func TestWorkProvenAt(t *testing.T) {
+	const hash = "0000a1b2c3d4"
+
+	if !blockchain.WorkProvenAt(hash, 16) {
+		t.Errorf("%s should meet difficulty 16", hash)
+	}
+	if blockchain.WorkProvenAt(hash, 17) {
+		t.Errorf("%s should not meet difficulty 17", hash)
+	}
+	if blockchain.WorkProvenAt("not hex", 0) {
+		t.Error("invalid hex should never count as proof-of-work")
+	}
+}
+
+func TestWorkProvenBits(t *testing.T) {
+	for _, c := range []struct {
+		hash []byte
+		bits int
+		want bool
+	}{
+		{[]byte{0x07, 0xff}, 5, true},
+		{[]byte{0x07, 0xff}, 6, false},
+		{[]byte{0x00, 0x40}, 9, true},
+		{[]byte{0x00, 0x40}, 10, false},
+		{[]byte{0x00, 0x00}, 16, true},
+		{[]byte{0x00, 0x00}, 17, false},
+		{[]byte{0xff}, 0, true},
+	} {
+		if got := blockchain.WorkProvenBits(c.hash, c.bits); got != c.want {
+			t.Errorf("WorkProvenBits(%x, %d) = %t, want %t", c.hash, c.bits, got, c.want)
+		}
+	}
+}
+
+func TestMineBits(t *testing.T) {
+	for _, difficulty := range []int{5, 9} {
+		block := blockchain.NewBlock(nil, []byte("bits"))
+		block.Mine(difficulty)
+		if !blockchain.WorkProvenBits(block.Hash(), difficulty) {
+			t.Errorf("block mined at %d bits has hash %s", difficulty, block.HashString())
+		}
+	}
+}
+
+func TestValidSignatures(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("signed")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	if err := block.SendTransaction(you, me.PublicKey(), []byte("also signed")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.Mine(difficulty)
+
+	if !chain.Valid() {
+		t.Error("blockchain with valid signatures is not valid")
+	}
+}
+
+func TestTamperedSignature(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("tampered")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.TamperSignature(0)
+	block.Mine(difficulty)
+
+	if chain.Valid() {
+		t.Error("blockchain with a tampered signature is valid")
+	}
+}
+
+func TestIdentityCurves(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			me := mustIdentity(blockchain.NewIdentityWithCurve(curve))
+			you := mustIdentity(blockchain.NewIdentityWithCurve(curve))
+
+			block := blockchain.NewBlock(nil, nil)
+			if err := block.SendTransaction(me, you.PublicKey(), []byte("curvy")); err != nil {
+				t.Fatalf("failed to send transaction: %s", err)
+			}
+			if !block.Transactions()[0].Verify() {
+				t.Error("transaction did not verify")
+			}
+		})
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte("deterministic"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	first, second := tx, tx
+	if err := first.SignDeterministic(me); err != nil {
+		t.Fatalf("failed to sign transaction: %s", err)
+	}
+	if err := second.SignDeterministic(me); err != nil {
+		t.Fatalf("failed to sign transaction: %s", err)
+	}
+	r1, s1, _ := first.Signature()
+	r2, s2, _ := second.Signature()
+	if r1.Cmp(r2) != 0 || s1.Cmp(s2) != 0 {
+		t.Error("deterministic signatures differ")
+	}
+	if !first.Verify() {
+		t.Error("deterministic signature did not verify")
+	}
+
+	random := tx
+	if err := random.Sign(me); err != nil {
+		t.Fatalf("failed to sign transaction: %s", err)
+	}
+	r3, s3, _ := random.Signature()
+	if r1.Cmp(r3) == 0 && s1.Cmp(s3) == 0 {
+		t.Error("randomized signature matches the deterministic one")
+	}
+}
+
+func TestUnsupportedKey(t *testing.T) {
+	me := mustIdentity(blockchain.NewIdentity())
+	// A copy of the curve parameters isn't recognized as a named curve, so
+	// the key can't be marshaled.
+	params := *elliptic.P256().Params()
+	unsupported := &ecdsa.PublicKey{Curve: &params, X: params.Gx, Y: params.Gy}
+
+	if _, err := blockchain.NewValueTransaction(me, unsupported, 1, nil); err == nil {
+		t.Error("expected an error sending to an unsupported key")
+	}
+	block := blockchain.NewBlock(nil, nil)
+	if err := block.SendTransaction(me, unsupported, nil); err == nil {
+		t.Error("expected an error sending to an unsupported key")
+	}
+	if len(block.Transactions()) != 0 {
+		t.Error("transaction to an unsupported key was added")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	message := []byte("it's really me")
+
+	r, s, err := me.Sign(message)
+	if err != nil {
+		t.Fatalf("failed to sign message: %s", err)
+	}
+	if !blockchain.VerifySignature(me.PublicKey(), message, r, s) {
+		t.Error("signature did not verify")
+	}
+	if blockchain.VerifySignature(me.PublicKey(), []byte("it's really you"), r, s) {
+		t.Error("signature verified for a tampered message")
+	}
+	if blockchain.VerifySignature(you.PublicKey(), message, r, s) {
+		t.Error("signature verified for the wrong public key")
+	}
+}
+
+func TestIdentityPEM(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	data, err := me.ExportPEM()
+	if err != nil {
+		t.Fatalf("failed to export identity: %s", err)
+	}
+	imported, err := blockchain.ImportIdentityPEM(data)
+	if err != nil {
+		t.Fatalf("failed to import identity: %s", err)
+	}
+	if !imported.PublicKey().Equal(me.PublicKey()) {
+		t.Error("imported identity has a different public key")
+	}
+
+	block := blockchain.NewBlock(nil, nil)
+	if err := block.SendTransaction(imported, you.PublicKey(), []byte("from disk")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	tx := block.Transactions()[0]
+	if !tx.Verify() {
+		t.Error("transaction signed by imported identity did not verify")
+	}
+	if want := mustHexKey(t, me.PublicKey()); tx.Sender() != want {
+		t.Errorf("sender = %s, want %s", tx.Sender(), want)
+	}
+}
+
+func TestImportIdentityPEMInvalid(t *testing.T) {
+	if _, err := blockchain.ImportIdentityPEM([]byte("not pem")); err == nil {
+		t.Error("expected an error for missing PEM block")
+	}
+	wrongType := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{0}})
+	if _, err := blockchain.ImportIdentityPEM(wrongType); err == nil {
+		t.Error("expected an error for wrong PEM block type")
+	}
+}
+
+func TestValidateProofOfWork(t *testing.T) {
+	const difficulty = 32
+
+	chain := blockchain.New(difficulty)
+	chain.NewBlock()
+
+	err := chain.Validate()
+	if err == nil || err.Error() != "block 0: invalid proof-of-work" {
+		t.Errorf("Validate error = %v, want %q", err, "block 0: invalid proof-of-work")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	const difficulty = 8
+
+	chain := blockchain.New(difficulty)
+	chain.Add([]byte("one"))
+	chain.Add([]byte("two"))
+	// An unmined block almost certainly can't meet a difficulty of 32.
+	chain.NewBlock().SetDifficulty(32)
+
+	var verr *blockchain.ValidationError
+	if err := chain.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("Validate error = %v, want a *ValidationError", err)
+	}
+	if verr.Height != 2 {
+		t.Errorf("height = %d, want 2", verr.Height)
+	}
+	if verr.Rule != "proof" {
+		t.Errorf("rule = %q, want %q", verr.Rule, "proof")
+	}
+	if verr.Err == nil || errors.Unwrap(verr) != verr.Err {
+		t.Error("ValidationError does not unwrap to its underlying error")
+	}
+}
+
+func TestValidateGenesisPrevHash(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	genesis := chain.NewBlock()
+	genesis.SetPrevHash([]byte("phantom"))
+	genesis.Mine(difficulty)
+	chain.Add([]byte("next"))
+
+	err := chain.Validate()
+	if want := "block 0: genesis block has a non-empty prevHash"; err == nil || err.Error() != want {
+		t.Errorf("Validate error = %v, want %q", err, want)
+	}
+}
+
+func TestValidateLinkage(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	first := chain.Add([]byte("first"))
+	chain.Add([]byte("second"))
+
+	if err := first.SendTransaction(me, you.PublicKey(), []byte("rewriting history")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	first.Mine(difficulty)
+
+	err := chain.Validate()
+	if err == nil || err.Error() != "block 1: prevHash mismatch" {
+		t.Errorf("Validate error = %v, want %q", err, "block 1: prevHash mismatch")
+	}
+}
+
+func TestValidateFrom(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	for i := 0; i < 4; i++ {
+		block := chain.NewBlock()
+		if err := block.SendTransaction(me, you.PublicKey(), []byte("validate me")); err != nil {
+			t.Fatalf("failed to send transaction: %s", err)
+		}
+		block.Mine(difficulty)
+	}
+
+	if ok, err := chain.ValidateFrom(2); !ok || err != nil {
+		t.Errorf("ValidateFrom(2) on a valid chain = %t, %v", ok, err)
+	}
+
+	// The signature is part of the block's hash, so the blocks after it are
+	// relinked to leave only the bad signature for ValidateFrom(0) to find.
+	corrupted, _ := chain.GetBlock(1)
+	corrupted.TamperSignature(0)
+	corrupted.Mine(difficulty)
+	if err := chain.Relink(); err != nil {
+		t.Fatalf("failed to relink chain: %s", err)
+	}
+
+	if ok, err := chain.ValidateFrom(2); !ok || err != nil {
+		t.Errorf("ValidateFrom(2) after corrupting block 1 = %t, %v", ok, err)
+	}
+	ok, err := chain.ValidateFrom(0)
+	if ok || err == nil {
+		t.Fatal("ValidateFrom(0) succeeded on a corrupted chain")
+	}
+	if !strings.HasPrefix(err.Error(), "block 1: ") {
+		t.Errorf("error %q does not identify block 1", err)
+	}
+
+	if _, err := chain.ValidateFrom(-1); err == nil {
+		t.Error("expected an error for a negative index")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	const difficulty = 2
+
+	chain := blockchain.New(difficulty)
+	first := chain.Add([]byte("hello blockchain"))
+	second := chain.Add([]byte("hello again"))
+
+	if chain.Len() != 2 {
+		t.Errorf("chain length = %d, want 2", chain.Len())
+	}
+	if string(second.Data()) != "hello again" {
+		t.Errorf("block data = %q, want %q", second.Data(), "hello again")
+	}
+	if !chain.WorkProven(first.HashString()) || !chain.WorkProven(second.HashString()) {
+		t.Error("added blocks were not mined")
+	}
+	if !chain.Valid() {
+		t.Error("blockchain is not valid")
+	}
+}
+
+func TestMineStandalone(t *testing.T) {
+	const difficulty = 12
+
+	block := blockchain.NewBlock(nil, []byte("standalone"))
+	if hash := block.Mine(difficulty); !strings.HasPrefix(hash, "000") {
+		t.Errorf("hash %s does not have %d leading zero bits", hash, difficulty)
+	}
+}
+
+func TestVerifyBlockPoW(t *testing.T) {
+	const difficulty = 3
+
+	mined := blockchain.NewBlock(nil, []byte("mined elsewhere"))
+	mined.Mine(difficulty)
+	if !blockchain.VerifyBlockPoW(mined, difficulty) {
+		t.Error("mined block does not verify")
+	}
+	if blockchain.VerifyBlockPoW(mined, difficulty+1) {
+		t.Error("block verifies at a higher difficulty than it commits to")
+	}
+
+	unmined := blockchain.NewBlock(nil, []byte("not mined"))
+	unmined.SetDifficulty(difficulty)
+	for blockchain.WorkProvenBits(unmined.Hash(), difficulty) {
+		unmined.SetNonce(unmined.Nonce() + 1)
+	}
+	if blockchain.VerifyBlockPoW(unmined, difficulty) {
+		t.Error("unmined block verifies")
+	}
+	if blockchain.VerifyBlockPoW(nil, difficulty) {
+		t.Error("nil block verifies")
+	}
+}
+
+func TestMineNegativeDifficulty(t *testing.T) {
+	block := blockchain.NewBlock(nil, []byte("standalone"))
+	if hash := block.Mine(-1); hash != block.HashString() {
+		t.Errorf("returned hash %s does not match block hash %s", hash, block.HashString())
+	}
+}
+
+func TestMineAlreadyMined(t *testing.T) {
+	const difficulty = 1
+
+	block := blockchain.NewBlock(nil, []byte("standalone"))
+	hash := block.Mine(difficulty)
+	nonce := block.Nonce()
+	if again := block.Mine(difficulty); again != hash || block.Nonce() != nonce {
+		t.Errorf("re-mining changed nonce from %d to %d", nonce, block.Nonce())
+	}
+	if _, stats := block.MineWithStats(); stats.Attempts != 1 {
+		t.Errorf("re-mining took %d attempts, want 1", stats.Attempts)
+	}
+}
+
+func TestMineCachesHash(t *testing.T) {
+	const difficulty = 4
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := blockchain.NewBlock(nil, []byte("cached"))
+	if block.CachedHash() != nil {
+		t.Error("unmined block has a cached hash")
+	}
+	hash := block.Mine(difficulty)
+	if got := hex.EncodeToString(block.CachedHash()); got != hash {
+		t.Errorf("cached hash = %s, want %s", got, hash)
+	}
+	if got := block.HashString(); got != hash {
+		t.Errorf("HashString = %s, want %s", got, hash)
+	}
+
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("hi")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	if block.CachedHash() != nil {
+		t.Error("adding a transaction did not clear the cached hash")
+	}
+	if block.HashString() == hash {
+		t.Error("hash did not change after adding a transaction")
+	}
+
+	block.Mine(difficulty)
+	block.SetNonce(block.Nonce() + 1)
+	if block.CachedHash() != nil {
+		t.Error("changing the nonce did not clear the cached hash")
+	}
+}
+
+func TestGenesis(t *testing.T) {
+	const difficulty = 2
+
+	chain := blockchain.New(difficulty)
+	genesis, err := chain.Genesis([]byte("in the beginning"))
+	if err != nil {
+		t.Fatalf("failed to create genesis block: %s", err)
+	}
+	if len(genesis.PrevHash()) != 0 {
+		t.Errorf("genesis prevHash = %x, want empty", genesis.PrevHash())
+	}
+	if !chain.WorkProven(genesis.HashString()) {
+		t.Error("genesis block does not have valid proof-of-work")
+	}
+	if _, err := chain.Genesis([]byte("again")); err == nil {
+		t.Error("expected an error creating a second genesis block")
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	for _, data := range []string{"zero", "one", "two"} {
+		chain.Add([]byte(data))
+	}
+
+	for i, want := range []string{"zero", "one", "two"} {
+		block, err := chain.GetBlock(i)
+		if err != nil {
+			t.Fatalf("failed to get block %d: %s", i, err)
+		}
+		if string(block.Data()) != want {
+			t.Errorf("block %d data = %q, want %q", i, block.Data(), want)
+		}
+		if block.Height() != i {
+			t.Errorf("block %d height = %d", i, block.Height())
+		}
+	}
+
+	for _, index := range []int{-1, chain.Len(), chain.Len() + 1} {
+		if _, err := chain.GetBlock(index); err == nil {
+			t.Errorf("expected an error for index %d", index)
+		}
+	}
+}
+
+func TestGetBlockByHash(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	chain.Add([]byte("first"))
+	middle := chain.Add([]byte("middle"))
+	chain.Add([]byte("last"))
+
+	block, ok := chain.GetBlockByHash(middle.HashString())
+	if !ok {
+		t.Fatal("middle block not found")
+	}
+	if block != middle {
+		t.Error("GetBlockByHash returned a different block")
+	}
+
+	if _, ok := chain.GetBlockByHash("deadbeef"); ok {
+		t.Error("found a block for an unknown hash")
+	}
+}
+
+func TestNewChainWithHasher(t *testing.T) {
+	const difficulty = 4
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	build := func(chain blockchain.Blockchain) blockchain.Blockchain {
+		for _, msg := range []string{"one", "two"} {
+			block := chain.NewBlock()
+			if err := block.SendTransaction(me, you.PublicKey(), []byte(msg)); err != nil {
+				t.Fatalf("failed to send transaction: %s", err)
+			}
+			block.Mine(difficulty)
+		}
+		return chain
+	}
+	chain := build(blockchain.NewChainWithHasher(difficulty, sha512.New))
+	if err := chain.Validate(); err != nil {
+		t.Fatalf("chain using SHA-512 is invalid: %s", err)
+	}
+
+	block, err := chain.GetBlock(1)
+	if err != nil {
+		t.Fatalf("failed to get block: %s", err)
+	}
+	if got := len(block.Hash()); got != sha512.Size {
+		t.Errorf("block hash is %d bytes, want %d", got, sha512.Size)
+	}
+	if got := len(block.Transactions()[0].Hash()); got != sha512.Size {
+		t.Errorf("transaction hash is %d bytes, want %d", got, sha512.Size)
+	}
+
+	defaults := build(blockchain.New(difficulty))
+	if got, other := blockHashes(chain), blockHashes(defaults); equalStrings(got, other) {
+		t.Error("chains using different hash functions have the same hashes")
+	}
+
+	// Signatures don't depend on the chain's hash function, so transactions
+	// made without a chain can still be mined into it.
+	var pool blockchain.Mempool
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	if got := len(chain.MineBlock(&pool, 1).Transactions()); got != 1 {
+		t.Errorf("mined block has %d transactions, want 1", got)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Fatalf("chain using SHA-512 is invalid after mining a pooled transaction: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := chain.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode chain: %s", err)
+	}
+	encoded := buf.Bytes()
+	if _, err := blockchain.Decode(bytes.NewReader(encoded)); err == nil {
+		t.Error("expected an error decoding a chain using SHA-512 as SHA-256")
+	}
+	decoded, err := blockchain.DecodeWithHasher(bytes.NewReader(encoded), sha512.New)
+	if err != nil {
+		t.Fatalf("failed to decode chain: %s", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Errorf("decoded chain using SHA-512 is invalid: %s", err)
+	}
+
+	// A chain replaced with one built elsewhere validates it under its own
+	// hash function.
+	replaced := blockchain.NewChainWithHasher(difficulty, sha512.New)
+	if err := replaced.ReplaceWith(defaults); err == nil {
+		t.Error("replaced a chain using SHA-512 with one using SHA-256")
+	}
+	if err := replaced.ReplaceWith(decoded); err != nil {
+		t.Errorf("failed to replace chain: %s", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	const (
+		difficulty = 1
+		keep       = 3
+	)
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	for i := 0; i < 10; i++ {
+		block := chain.NewBlock()
+		sendValue(t, block, me, you, 1)
+		block.Mine(difficulty)
+	}
+	hashes := blockHashes(chain)
+
+	if err := chain.Prune(keep); err != nil {
+		t.Fatalf("failed to prune chain: %s", err)
+	}
+	if got := blockHashes(chain); !equalStrings(got, hashes) {
+		t.Errorf("pruned chain hashes = %v, want %v", got, hashes)
+	}
+	for block := range chain.Blocks() {
+		kept := block.Height() >= chain.Len()-keep
+		if block.Pruned() == kept {
+			t.Errorf("block %d: pruned = %t, want %t", block.Height(), block.Pruned(), !kept)
+		}
+		if got := len(block.Transactions()); kept && got != 1 || !kept && got != 0 {
+			t.Errorf("block %d has %d transactions", block.Height(), got)
+		}
+	}
+	if ok, err := chain.ValidateFrom(chain.Len() - keep); !ok {
+		t.Errorf("kept blocks are invalid: %s", err)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Errorf("pruned chain is invalid: %s", err)
+	}
+}
+
+func TestBlockchainString(t *testing.T) {
+	chain := chainOfLength(3)
+	s := chain.String()
+	if !strings.HasPrefix(s, "blockchain of 3 blocks at difficulty 1\n") {
+		t.Errorf("unexpected header in %q", s)
+	}
+	for _, hash := range blockHashes(chain) {
+		if !strings.Contains(s, hash) {
+			t.Errorf("chain string does not contain block %s", hash)
+		}
+	}
+}
+
+func TestTip(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	if _, ok := chain.Tip(); ok {
+		t.Error("empty chain has a tip")
+	}
+
+	chain.Add([]byte("first"))
+	chain.Add([]byte("second"))
+	last := chain.Add([]byte("third"))
+	tip, ok := chain.Tip()
+	if !ok {
+		t.Fatal("tip not found")
+	}
+	if tip != last {
+		t.Errorf("tip = %s, want %s", tip.HashString(), last.HashString())
+	}
+}
+
+func TestRetargetFastBlocks(t *testing.T) {
+	const (
+		initialDifficulty = 1
+		window            = 2
+	)
+
+	chain := blockchain.NewWithTarget(initialDifficulty, time.Hour, window)
+	for i := 0; i <= window; i++ {
+		if got := chain.NextDifficulty(); got != initialDifficulty {
+			t.Fatalf("difficulty before %d blocks = %d, want %d", i, got, initialDifficulty)
+		}
+		chain.Add([]byte("fast"))
+	}
+
+	if got := chain.NextDifficulty(); got != initialDifficulty+1 {
+		t.Errorf("difficulty after fast blocks = %d, want %d", got, initialDifficulty+1)
+	}
+	if block := chain.Add([]byte("harder")); block.Difficulty() != initialDifficulty+1 {
+		t.Errorf("new block difficulty = %d, want %d", block.Difficulty(), initialDifficulty+1)
+	}
+	if !chain.Valid() {
+		t.Error("retargeted blockchain is not valid")
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	const (
+		difficulty    = 1
+		goroutines    = 50
+		blocksPerEach = 2
+	)
+
+	chain := blockchain.New(difficulty)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < blocksPerEach; j++ {
+				chain.Add([]byte("concurrent"))
+				chain.Len()
+				chain.Valid()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := chain.Len(), goroutines*blocksPerEach; got != want {
+		t.Errorf("chain length = %d, want %d", got, want)
+	}
+	if !chain.Valid() {
+		t.Error("blockchain is not valid")
+	}
+}
+
+func TestForEachReentrant(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	chain.Add([]byte("first"))
+	chain.ForEach(func(*blockchain.Block) {
+		chain.Add([]byte("added during iteration"))
+	})
+	if chain.Len() != 2 {
+		t.Errorf("chain length = %d, want 2", chain.Len())
+	}
+}
+
+func TestBalance(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	block := chain.NewBlock()
+	sendValue(t, block, me, you, 30)
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("no value")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.Mine(difficulty)
+
+	block = chain.NewBlock()
+	sendValue(t, block, you, me, 5)
+	block.Mine(difficulty)
+
+	if got := chain.Balance(me.PublicKey()); got != -25 {
+		t.Errorf("sender balance = %d, want -25", got)
+	}
+	if got := chain.Balance(you.PublicKey()); got != 25 {
+		t.Errorf("receiver balance = %d, want 25", got)
+	}
+	if !chain.Valid() {
+		t.Error("blockchain is not valid")
+	}
+}
+
+func TestFees(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	miner := mustIdentity(blockchain.NewIdentity())
+
+	block := blockchain.NewBlockForMiner(nil, miner.PublicKey(), nil)
+	for _, fee := range []uint64{1, 2, 3} {
+		tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), 10, fee, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := block.AddTransaction(tx); err != nil {
+			t.Fatalf("failed to add transaction: %s", err)
+		}
+	}
+	if got := block.TotalFees(); got != 6 {
+		t.Errorf("total fees = %d, want 6", got)
+	}
+}
+
+func TestFeeBalance(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	miner := mustIdentity(blockchain.NewIdentity())
+
+	block := blockchain.NewBlockForMiner(nil, miner.PublicKey(), nil)
+	tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), 10, 2, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := block.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != nil {
+		t.Fatalf("failed to append block: %s", err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		identity blockchain.Identity
+		want     int64
+	}{
+		{"sender", me, -12},
+		{"receiver", you, 10},
+		{"miner", miner, 2},
+	} {
+		if got := chain.Balance(c.identity.PublicKey()); got != c.want {
+			t.Errorf("%s balance = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSignAll(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	var txs []*blockchain.Transaction
+	for _, from := range []blockchain.Identity{me, you, me, you} {
+		tx, err := blockchain.NewValueTransaction(from, me.PublicKey(), 1, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		tx.SetSignature(nil, nil)
+		txs = append(txs, &tx)
+	}
+
+	err := me.SignAll(txs)
+	if err == nil {
+		t.Fatal("expected an error signing transactions sent by someone else")
+	}
+	if want := "blockchain.Identity.SignAll: not the sender of transactions 1, 3"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	for i, tx := range txs {
+		if want := i%2 == 0; tx.Verify() != want {
+			t.Errorf("transaction %d: verified = %t, want %t", i, tx.Verify(), want)
+		}
+	}
+
+	if err := me.SignAll([]*blockchain.Transaction{txs[0], txs[2]}); err != nil {
+		t.Errorf("failed to sign own transactions: %s", err)
+	}
+}
+
+func TestVerifyInvalidSender(t *testing.T) {
+	me := mustIdentity(blockchain.NewIdentityWithCurve(elliptic.P256()))
+	you := mustIdentity(blockchain.NewIdentity())
+	for _, c := range []struct {
+		name   string
+		sender *ecdsa.PublicKey
+	}{
+		{"nil sender", nil},
+		{"nil curve", &ecdsa.PublicKey{X: me.PublicKey().X, Y: me.PublicKey().Y}},
+		{"mismatched curve", &ecdsa.PublicKey{Curve: elliptic.P224(), X: me.PublicKey().X, Y: me.PublicKey().Y}},
+	} {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte("from nowhere"))
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		tx.SetSender(c.sender)
+		if tx.Verify() {
+			t.Errorf("%s: transaction verified", c.name)
+		}
+		if tx.Signed() {
+			t.Errorf("%s: transaction reported as signed", c.name)
+		}
+	}
+}
+
+func TestSetSignature(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	r, s, ok := tx.Signature()
+	if !ok {
+		t.Fatal("signed transaction has no signature")
+	}
+
+	tx.SetSignature(nil, nil)
+	if _, _, ok := tx.Signature(); ok {
+		t.Error("cleared signature is still present")
+	}
+	if tx.Verify() {
+		t.Error("transaction without a signature verifies")
+	}
+
+	tx.SetSignature(r, s)
+	if !tx.Verify() {
+		t.Error("transaction with its signature reattached does not verify")
+	}
+}
+
+func TestSignatureDER(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	der, err := tx.SignatureDER()
+	if err != nil {
+		t.Fatalf("failed to encode signature: %s", err)
+	}
+	if !ecdsa.VerifyASN1(me.PublicKey(), tx.SigningHash(), der) {
+		t.Error("DER signature does not verify against the transaction hash")
+	}
+
+	tx.SetSignature(nil, nil)
+	if _, err := tx.SignatureDER(); err == nil {
+		t.Error("expected an error encoding a missing signature")
+	}
+	if err := tx.SetSignatureDER(der); err != nil {
+		t.Fatalf("failed to parse signature: %s", err)
+	}
+	if !tx.Verify() {
+		t.Error("transaction with a parsed DER signature does not verify")
+	}
+	if err := tx.SetSignatureDER(der[:len(der)-1]); err == nil {
+		t.Error("expected an error parsing a truncated signature")
+	}
+}
+
+func TestAlteredFee(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), 10, 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	tx.SetFee(0)
+	if tx.Verify() {
+		t.Error("transaction with an altered fee still verifies")
+	}
+}
+
+func TestMaxTxPerBlock(t *testing.T) {
+	const (
+		difficulty = 1
+		limit      = 2
+	)
+
+	chain := blockchain.NewWithLimit(difficulty, limit)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	for i := 0; i < limit; i++ {
+		if err := block.SendTransaction(me, you.PublicKey(), []byte("fits")); err != nil {
+			t.Fatalf("failed to send transaction %d: %s", i, err)
+		}
+	}
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("overflow")); err == nil {
+		t.Error("expected an error exceeding the transaction limit")
+	}
+}
+
+func TestMaxTxPerBlockUnlimited(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	for i := 0; i < 10; i++ {
+		if err := block.SendTransaction(me, you.PublicKey(), []byte("unlimited")); err != nil {
+			t.Fatalf("failed to send transaction %d: %s", i, err)
+		}
+	}
+}
+
+func TestDuplicateTransaction(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 10, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	block := chain.NewBlock()
+	if err := block.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	if err := block.AddTransaction(tx); err == nil {
+		t.Error("expected an error adding a duplicate transaction")
+	}
+	block.Mine(difficulty)
+
+	if !chain.HasTransaction(tx.Hash()) {
+		t.Error("committed transaction not found")
+	}
+	other, err := blockchain.NewValueTransaction(me, you.PublicKey(), 10, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if chain.HasTransaction(other.Hash()) {
+		t.Error("found a transaction that was never committed")
+	}
+}
+
+func TestTransactionTimestampHashed(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte("same data"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	later := tx
+	later.SetTimestamp(tx.Timestamp().Add(time.Second))
+
+	if bytes.Equal(tx.Hash(), later.Hash()) {
+		t.Error("transactions with different timestamps have the same hash")
+	}
+	if later.Verify() {
+		t.Error("changing the timestamp did not invalidate the signature")
+	}
+}
+
+func TestTimestampOrder(t *testing.T) {
+	const difficulty = 1
+
+	start := time.Now()
+	for _, c := range []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"earlier", -time.Second, false},
+		{"equal", 0, true},
+		{"later", time.Second, true},
+	} {
+		chain := blockchain.New(difficulty)
+		first := chain.NewBlock()
+		first.SetTimestamp(start)
+		first.Mine(difficulty)
+		second := chain.NewBlock()
+		second.SetTimestamp(start.Add(c.offset))
+		second.Mine(difficulty)
+
+		err := chain.Validate()
+		if c.valid && err != nil {
+			t.Errorf("%s timestamp: chain is invalid: %s", c.name, err)
+		}
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%s timestamp: chain is valid", c.name)
+			} else if !strings.HasPrefix(err.Error(), "block 1: ") {
+				t.Errorf("%s timestamp: error %q does not name block 1", c.name, err)
+			}
+		}
+	}
+
+	chain := blockchain.New(difficulty)
+	tip := chain.Add([]byte("tip"))
+	early := blockchain.NewBlock(tip.Hash(), nil)
+	early.SetTimestamp(tip.Timestamp().Add(-time.Second))
+	early.Mine(difficulty)
+	if err := chain.AppendBlock(early); err != blockchain.ErrTimestampTooEarly {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrTimestampTooEarly)
+	}
+}
+
+func TestMaxFutureDrift(t *testing.T) {
+	const difficulty = 1
+
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	for _, c := range []struct {
+		ahead time.Duration
+		valid bool
+	}{
+		{time.Hour, true},
+		{3 * time.Hour, false},
+	} {
+		chain := blockchain.NewChain(blockchain.WithDifficulty(difficulty), blockchain.WithClock(clock))
+		block := chain.NewBlock()
+		block.SetTimestamp(now.Add(c.ahead))
+		block.Mine(difficulty)
+
+		if err := chain.Validate(); c.valid && err != nil {
+			t.Errorf("block %s ahead: chain is invalid: %s", c.ahead, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("block %s ahead: chain is valid", c.ahead)
+		}
+	}
+
+	chain := blockchain.NewChain(blockchain.WithDifficulty(difficulty), blockchain.WithClock(clock))
+	block := blockchain.NewBlock(nil, nil)
+	block.SetTimestamp(now.Add(3 * time.Hour))
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != blockchain.ErrTimestampTooLate {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrTimestampTooLate)
+	}
+}
+
+func TestReplayedTransaction(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 5, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	first := chain.NewBlock()
+	if err := first.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	first.Mine(difficulty)
+
+	replay := blockchain.NewBlock(first.Hash(), nil)
+	if err := replay.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	replay.Mine(difficulty)
+	if err := chain.AppendBlock(replay); err != blockchain.ErrDuplicateTransaction {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrDuplicateTransaction)
+	}
+
+	second := chain.NewBlock()
+	if err := second.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	second.Mine(difficulty)
+	err = chain.Validate()
+	if err == nil {
+		t.Fatal("chain replaying a transaction is valid")
+	}
+	if want := "block 1: transaction 0 already appears in block 0"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestBlockMeta(t *testing.T) {
+	const difficulty = 4
+
+	tagged := blockchain.NewBlock(nil, []byte("same data"))
+	tagged.SetMeta("version", "1.0")
+	tagged.SetMeta("miner", "rig-7")
+	other := tagged.Clone()
+	other.SetMeta("miner", "rig-8")
+	if bytes.Equal(tagged.Hash(), other.Hash()) {
+		t.Error("blocks with different metadata have the same hash")
+	}
+
+	hash := tagged.Mine(difficulty)
+	if got := tagged.HashString(); got != hash {
+		t.Errorf("recomputed hash = %s, want %s", got, hash)
+	}
+	if got, ok := tagged.Meta("miner"); !ok || got != "rig-7" {
+		t.Errorf("Meta(miner) = %q, %t, want %q, true", got, ok, "rig-7")
+	}
+	if _, ok := tagged.Meta("missing"); ok {
+		t.Error("found metadata that was never set")
+	}
+}
+
+func TestBlockEqual(t *testing.T) {
+	const difficulty = 1
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := blockchain.NewBlockForMiner([]byte("prev"), me.PublicKey(), []byte("data"))
+	sendValue(t, block, me, you, 3)
+	block.SetMeta("key", "value")
+	block.Mine(difficulty)
+
+	if !block.Equal(block.Clone()) {
+		t.Error("block is not equal to its clone")
+	}
+	if block.Equal(nil) {
+		t.Error("block is equal to nil")
+	}
+	for _, c := range []struct {
+		name   string
+		modify func(*blockchain.Block)
+	}{
+		{"prevHash", func(b *blockchain.Block) { b.SetPrevHash([]byte("other")) }},
+		{"timestamp", func(b *blockchain.Block) { b.SetTimestamp(b.Timestamp().Add(time.Second)) }},
+		{"nonce", func(b *blockchain.Block) { b.SetNonce(b.Nonce() + 1) }},
+		{"difficulty", func(b *blockchain.Block) { b.SetDifficulty(b.Difficulty() + 1) }},
+		{"metadata", func(b *blockchain.Block) { b.SetMeta("key", "other") }},
+		{"transaction", func(b *blockchain.Block) { b.SetTransactionData(0, []byte("other")) }},
+		{"transaction count", func(b *blockchain.Block) { sendValue(t, b, you, me, 1) }},
+	} {
+		other := block.Clone()
+		c.modify(other)
+		if block.Equal(other) {
+			t.Errorf("blocks with different %s are equal", c.name)
+		}
+	}
+}
+
+func TestTransactionEqual(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), 10, 1, []byte("data"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if !tx.Equal(tx) {
+		t.Error("transaction is not equal to itself")
+	}
+
+	reversed, err := blockchain.NewFeeTransaction(you, me.PublicKey(), 10, 1, []byte("data"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	for _, c := range []struct {
+		name   string
+		modify func(*blockchain.Transaction)
+	}{
+		{"keys", func(other *blockchain.Transaction) { *other = reversed }},
+		{"fee", func(other *blockchain.Transaction) { other.SetFee(2) }},
+		{"timestamp", func(other *blockchain.Transaction) { other.SetTimestamp(tx.Timestamp().Add(time.Second)) }},
+		{"random", func(other *blockchain.Transaction) { other.SetRandom([]byte("other")) }},
+		{"signature", func(other *blockchain.Transaction) {
+			if err := other.SignDeterministic(me); err != nil {
+				t.Fatalf("failed to sign transaction: %s", err)
+			}
+		}},
+	} {
+		other := tx
+		c.modify(&other)
+		if tx.Equal(other) {
+			t.Errorf("transactions with different %s are equal", c.name)
+		}
+	}
+}
+
+func TestTransactionKind(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	message, err := blockchain.NewMessageTransaction(me, you.PublicKey(), []byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	contract, err := blockchain.NewContractTransaction(me, you.PublicKey(), 5, []byte("call()"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	transfer, err := blockchain.NewValueTransaction(me, you.PublicKey(), 5, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	for _, c := range []struct {
+		tx   blockchain.Transaction
+		want blockchain.TxKind
+	}{
+		{message, blockchain.TxMessage},
+		{contract, blockchain.TxContract},
+		{transfer, blockchain.TxTransfer},
+	} {
+		if got := c.tx.Kind(); got != c.want {
+			t.Errorf("kind = %s, want %s", got, c.want)
+		}
+		data, err := c.tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal transaction: %s", err)
+		}
+		decoded, err := blockchain.UnmarshalTransaction(data)
+		if err != nil {
+			t.Fatalf("failed to unmarshal transaction: %s", err)
+		}
+		if got := decoded.Kind(); got != c.want {
+			t.Errorf("decoded kind = %s, want %s", got, c.want)
+		}
+	}
+
+	other := contract
+	other.SetKind(blockchain.TxTransfer)
+	if bytes.Equal(contract.Hash(), other.Hash()) {
+		t.Error("transactions of different kinds have the same hash")
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	// An empty block on an empty chain holds only its timestamp and nonce.
+	const emptySize = 8 + 4
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	var (
+		transactions []blockchain.Transaction
+		sizes        []int
+	)
+	for i := 0; i < 3; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), uint64(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal transaction: %s", err)
+		}
+		transactions = append(transactions, tx)
+		sizes = append(sizes, len(data))
+	}
+
+	// Leave room for exactly the first two transactions.
+	chain := blockchain.NewChain(blockchain.WithMaxBlockSize(emptySize + sizes[0] + sizes[1]))
+	block := chain.NewBlock()
+	want := emptySize
+	if got := block.Size(); got != want {
+		t.Errorf("empty block size = %d, want %d", got, want)
+	}
+	for i, tx := range transactions[:2] {
+		if err := block.AddTransaction(tx); err != nil {
+			t.Fatalf("failed to add transaction %d: %s", i, err)
+		}
+		want += sizes[i]
+		if got := block.Size(); got != want {
+			t.Errorf("size after %d transactions = %d, want %d", i+1, got, want)
+		}
+	}
+	if err := block.AddTransaction(transactions[2]); err == nil {
+		t.Error("expected an error exceeding the maximum block size")
+	}
+}
+
+func TestContainsTransaction(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := blockchain.NewBlock(nil, nil)
+	sendValue(t, block, me, you, 1)
+	sendValue(t, block, you, me, 2)
+
+	if !block.ContainsTransaction(block.Transactions()[1].Hash()) {
+		t.Error("transaction in the block not found")
+	}
+	if block.ContainsTransaction(make([]byte, 32)) {
+		t.Error("found a transaction that isn't in the block")
+	}
+}
+
+func sendValue(t *testing.T, block *blockchain.Block, from, to blockchain.Identity, amount uint64) {
+	t.Helper()
+
+	tx, err := blockchain.NewValueTransaction(from, to.PublicKey(), amount, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := block.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+}
+
+func TestHashIncludesDifficulty(t *testing.T) {
+	block := blockchain.NewBlock(nil, []byte("same data"))
+	other := *block
+	block.SetDifficulty(2)
+	other.SetDifficulty(6)
+
+	if block.HashString() == other.HashString() {
+		t.Error("blocks with different difficulties have the same hash")
+	}
+}
+
+func TestHashIgnoresTimeZone(t *testing.T) {
+	instant := time.Date(2018, time.January, 2, 3, 4, 5, 6, time.UTC)
+
+	var hashes []string
+	for _, loc := range []*time.Location{time.UTC, time.Local, time.FixedZone("UTC+5", 5*60*60)} {
+		block := blockchain.NewBlock(nil, []byte("timeless"))
+		block.SetTimestamp(instant.In(loc))
+		if !block.Timestamp().Equal(instant) || block.Timestamp().Location() != time.UTC {
+			t.Errorf("timestamp = %s, want %s", block.Timestamp(), instant)
+		}
+		hashes = append(hashes, block.HashString())
+	}
+	for _, hash := range hashes[1:] {
+		if hash != hashes[0] {
+			t.Errorf("hash %s differs from %s for the same instant", hash, hashes[0])
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	chain.Add([]byte("first"))
+	last := chain.NewBlock()
+	if err := last.SendTransaction(me, you.PublicKey(), []byte("original")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	originalHash := last.Mine(difficulty)
+
+	clone := chain.Clone()
+	cloneLast, err := clone.GetBlock(clone.Len() - 1)
+	if err != nil {
+		t.Fatalf("failed to get cloned block: %s", err)
+	}
+	if cloneLast == last {
+		t.Fatal("clone shares blocks with the original")
+	}
+	if err := cloneLast.SendTransaction(me, you.PublicKey(), []byte("speculative")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	cloneLast.Mine(difficulty + 1)
+
+	if last.HashString() != originalHash {
+		t.Error("mining the clone changed the original block")
+	}
+	if len(last.Transactions()) != 1 {
+		t.Errorf("original block has %d transactions, want 1", len(last.Transactions()))
+	}
+	clone.Add([]byte("fork"))
+	if chain.Len() != 2 {
+		t.Errorf("original chain length = %d, want 2", chain.Len())
+	}
+	if !chain.Valid() || !clone.Valid() {
+		t.Error("original or cloned chain is not valid")
+	}
+}
+
+func TestAppendBlock(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tip := chain.Add([]byte("local"))
+
+	block := blockchain.NewBlock(tip.Hash(), []byte("from a peer"))
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("hi")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != nil {
+		t.Fatalf("failed to append block: %s", err)
+	}
+	if chain.Len() != 2 || !chain.Valid() {
+		t.Error("chain is not valid after appending a block")
+	}
+
+	stale := blockchain.NewBlock(tip.Hash(), []byte("stale"))
+	stale.Mine(difficulty)
+	if err := chain.AppendBlock(stale); err != blockchain.ErrPrevHashMismatch {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrPrevHashMismatch)
+	}
+
+	forged := blockchain.NewBlock(block.Hash(), nil)
+	if err := forged.SendTransaction(me, you.PublicKey(), []byte("forged")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	forged.TamperSignature(0)
+	forged.Mine(difficulty)
+	if err := chain.AppendBlock(forged); err != blockchain.ErrInvalidSignature {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrInvalidSignature)
+	}
+}
+
+func TestTransactionsSorted(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tip := chain.Add([]byte("genesis"))
+
+	block := blockchain.NewBlock(tip.Hash(), nil)
+	var added [][]byte
+	for i := 0; i < 8; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), uint64(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := block.AddTransaction(tx); err != nil {
+			t.Fatalf("failed to add transaction: %s", err)
+		}
+		added = append(added, tx.Hash())
+	}
+	var hashes [][]byte
+	for _, tx := range block.Transactions() {
+		hashes = append(hashes, tx.Hash())
+	}
+	if len(hashes) != len(added) || !slices.IsSortedFunc(hashes, bytes.Compare) {
+		t.Errorf("transactions are not sorted by hash: %x", hashes)
+	}
+
+	unsorted := block.Clone()
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != nil {
+		t.Fatalf("failed to append block: %s", err)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Errorf("chain with sorted transactions is not valid: %s", err)
+	}
+
+	unsorted.SetPrevHash(block.Hash())
+	unsorted.SwapTransactions(0, 1)
+	unsorted.Mine(difficulty)
+	if err := chain.AppendBlock(unsorted); err != blockchain.ErrUnsortedTransactions {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrUnsortedTransactions)
+	}
+}
+
+func TestValidateUnsortedTransactions(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	for _, msg := range []string{"one", "two"} {
+		if err := block.SendTransaction(me, you.PublicKey(), []byte(msg)); err != nil {
+			t.Fatalf("failed to send transaction: %s", err)
+		}
+	}
+	block.SwapTransactions(0, 1)
+	block.Mine(difficulty)
+
+	var verr *blockchain.ValidationError
+	if err := chain.Validate(); !errors.As(err, &verr) || verr.Rule != "order" {
+		t.Errorf("Validate error = %v, want an order violation", err)
+	}
+}
+
+func TestAppendBlockInsufficientWork(t *testing.T) {
+	const difficulty = 32
+
+	chain := blockchain.New(difficulty)
+	block := blockchain.NewBlock(nil, []byte("lazy"))
+	if err := chain.AppendBlock(block); err != blockchain.ErrInsufficientWork {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrInsufficientWork)
+	}
+	if chain.Len() != 0 {
+		t.Error("block with insufficient work was appended")
+	}
+}
+
+func TestForEachUntil(t *testing.T) {
+	chain := chainOfLength(5)
+
+	calls := 0
+	chain.ForEachUntil(func(*blockchain.Block) bool {
+		calls++
+		return calls < 2
+	})
+	if calls != 2 {
+		t.Errorf("f was called %d times, want 2", calls)
+	}
+}
+
+func TestForEachTransaction(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	for i := 1; i <= 3; i++ {
+		block := chain.NewBlock()
+		for j := 0; j < i; j++ {
+			sendValue(t, block, me, you, uint64(j))
+		}
+		block.Mine(difficulty)
+	}
+
+	count := 0
+	chain.ForEachTransaction(func(block *blockchain.Block, tx blockchain.Transaction) {
+		if !block.ContainsTransaction(tx.Hash()) {
+			t.Errorf("transaction visited with block %d, which doesn't contain it", block.Height())
+		}
+		count++
+	})
+	if count != 6 {
+		t.Errorf("visited %d transactions, want 6", count)
+	}
+}
+
+func TestBlocksIterator(t *testing.T) {
+	chain := chainOfLength(5)
+
+	visited := 0
+	for block := range chain.Blocks() {
+		visited++
+		if block.Height() == 2 {
+			break
+		}
+	}
+	if visited != 3 {
+		t.Errorf("visited %d blocks, want 3", visited)
+	}
+}
+
+func TestAllTransactions(t *testing.T) {
+	block := blockWithTransactions(t, 3)
+
+	var indices []int
+	for i, tx := range block.AllTransactions() {
+		if !tx.Verify() {
+			t.Errorf("transaction %d did not verify", i)
+		}
+		indices = append(indices, i)
+		if i == 1 {
+			break
+		}
+	}
+	if len(indices) != 2 || indices[0] != 0 || indices[1] != 1 {
+		t.Errorf("visited indices %v, want [0 1]", indices)
+	}
+}
+
+func TestMineContextCancel(t *testing.T) {
+	const difficulty = 64
+
+	chain := blockchain.New(difficulty)
+	block := chain.NewBlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := block.MineContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("MineContext error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMineUntil(t *testing.T) {
+	hard := blockchain.NewBlock(nil, []byte("out of time"))
+	hard.SetDifficulty(64)
+	if _, ok := hard.MineUntil(time.Now().Add(time.Millisecond)); ok {
+		t.Error("mined a block at difficulty 64 before the deadline")
+	}
+
+	const difficulty = 2
+
+	easy := blockchain.NewBlock(nil, []byte("plenty of time"))
+	easy.SetDifficulty(difficulty)
+	hash, ok := easy.MineUntil(time.Now().Add(time.Minute))
+	if !ok {
+		t.Fatal("failed to mine a block at difficulty 2 before the deadline")
+	}
+	if got := easy.HashString(); got != hash {
+		t.Errorf("block hash = %s, want %s", got, hash)
+	}
+	if !blockchain.WorkProvenAt(hash, difficulty) {
+		t.Errorf("hash %s does not meet difficulty %d", hash, difficulty)
+	}
+}
+
+func TestMineBounded(t *testing.T) {
+	const difficulty = 64
+
+	block := blockchain.NewBlock(nil, []byte("too hard"))
+	block.SetDifficulty(difficulty)
+	if _, err := block.MineBounded(10); err != blockchain.ErrMiningExhausted {
+		t.Errorf("MineBounded error = %v, want %v", err, blockchain.ErrMiningExhausted)
+	}
+}
+
+func TestMineNonceOverflow(t *testing.T) {
+	const difficulty = 8
+
+	block := blockchain.NewBlock(nil, []byte("wrap around"))
+	block.SetDifficulty(difficulty)
+	block.SetNonce(math.MaxUint32)
+	start := block.Timestamp()
+
+	hash, err := block.MineBounded(1 << 16)
+	if err != nil {
+		t.Fatalf("failed to mine block: %s", err)
+	}
+	if !blockchain.WorkProvenAt(hash, difficulty) {
+		t.Errorf("hash %s does not meet difficulty %d", hash, difficulty)
+	}
+	if block.Nonce() != math.MaxUint32 && !block.Timestamp().After(start) {
+		t.Error("nonce wrapped around without changing the timestamp")
+	}
+}
+
+func TestMineRange(t *testing.T) {
+	const difficulty = 8
+
+	// Find the first solution, making sure there are nonces before it.
+	var block *blockchain.Block
+	var solution uint32
+	for i := 0; solution == 0; i++ {
+		block = blockchain.NewBlock(nil, []byte("range "+strconv.Itoa(i)))
+		block.SetDifficulty(difficulty)
+		block.SetNonce(0)
+		probe := block.Clone()
+		probe.Mine(difficulty)
+		solution = probe.Nonce()
+	}
+
+	if hash, ok := block.Clone().MineRange(0, solution); ok {
+		t.Errorf("found solution %s before the first one", hash)
+	}
+	upper := block.Clone()
+	hash, ok := upper.MineRange(solution, 2*solution)
+	if !ok {
+		t.Fatal("did not find the solution in the half containing it")
+	}
+	if upper.Nonce() != solution || hash != upper.HashString() {
+		t.Errorf("MineRange found nonce %d with hash %s, want nonce %d", upper.Nonce(), hash, solution)
+	}
+
+	if _, ok := block.MineRange(solution, solution); ok || block.Nonce() != 0 {
+		t.Errorf("empty range found a solution or moved the nonce to %d", block.Nonce())
+	}
+}
+
+func TestMineWithProgress(t *testing.T) {
+	const difficulty = 14
+
+	block := blockchain.NewBlock(nil, []byte("are we there yet"))
+	block.SetDifficulty(difficulty)
+	var calls int
+	var last uint64
+	hash := block.MineWithProgress(func(attempts uint64) {
+		calls++
+		last = attempts
+	})
+	if !blockchain.WorkProvenAt(hash, difficulty) {
+		t.Fatalf("hash %s does not meet difficulty %d", hash, difficulty)
+	}
+
+	// The nonce starts at zero, so it took one more attempt than the final nonce.
+	attempts := uint64(block.Nonce()) + 1
+	if want := int(attempts / blockchain.MineReportInterval); calls != want {
+		t.Errorf("report called %d times for %d attempts, want %d", calls, attempts, want)
+	}
+	if calls > 0 && last != uint64(calls)*blockchain.MineReportInterval {
+		t.Errorf("last reported count = %d, want %d", last, uint64(calls)*blockchain.MineReportInterval)
+	}
+}
+
+func TestMineWithStats(t *testing.T) {
+	const difficulty = 2
+
+	block := blockchain.NewBlock(nil, []byte("how fast"))
+	block.SetDifficulty(difficulty)
+	hash, stats := block.MineWithStats()
+	if !blockchain.WorkProvenAt(hash, difficulty) {
+		t.Fatalf("hash %s does not meet difficulty %d", hash, difficulty)
+	}
+	if stats.Attempts == 0 {
+		t.Error("expected at least one attempt")
+	}
+	if math.IsInf(stats.HashesPerSec, 0) || math.IsNaN(stats.HashesPerSec) || stats.HashesPerSec <= 0 {
+		t.Errorf("hashes per second = %v, want a finite positive number", stats.HashesPerSec)
+	}
+}
+
+func TestMineParallel(t *testing.T) {
+	const difficulty = 12
+
+	chain := blockchain.New(difficulty)
+	block := chain.NewBlock()
+	hash := block.MineParallel(4)
+	if hash != block.HashString() {
+		t.Errorf("returned hash %s does not match block hash %s", hash, block.HashString())
+	}
+	if !chain.Valid() {
+		t.Error("blockchain is not valid")
+	}
+}
+
+func TestMineParallelNonceOverflow(t *testing.T) {
+	const difficulty = 8
+
+	block := blockchain.New(difficulty).NewBlock()
+	block.SetNonce(math.MaxUint32)
+	timestamp := block.Timestamp()
+	block.MineParallel(4)
+	if !blockchain.VerifyBlockPoW(block, difficulty) {
+		t.Fatal("block was not mined")
+	}
+	// Only the first worker starts before the nonce wraps around, and the
+	// others have to move the timestamp on to avoid repeating hashes.
+	if block.Nonce() != math.MaxUint32 && !block.Timestamp().Equal(timestamp.Add(time.Nanosecond)) {
+		t.Errorf("nonce wrapped around to %d without advancing the timestamp", block.Nonce())
+	}
+}
+
+func BenchmarkMine(b *testing.B) {
+	const difficulty = 20
+
+	chain := blockchain.New(difficulty)
+	for i := 0; i < b.N; i++ {
+		chain.NewBlock().Mine(difficulty)
+	}
+}
+
+func BenchmarkMineParallel(b *testing.B) {
+	const difficulty = 20
+
+	chain := blockchain.New(difficulty)
+	for i := 0; i < b.N; i++ {
+		chain.NewBlock().MineParallel(runtime.NumCPU())
+	}
+}
+
+func mustHexKey(t *testing.T, pub *ecdsa.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+	return hex.EncodeToString(der)
+}
+
 func mustIdentity(identity blockchain.Identity, err error) blockchain.Identity {
 	if err != nil {
 		panic(err)
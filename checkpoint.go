@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// Checkpoint records the hash of the block at a given height, so that the
+// chain up to that block can be trusted without validating it again.
+type Checkpoint struct {
+	Height int
+	Hash   []byte
+}
+
+// Checkpoint returns a checkpoint for the block at the given height.
+func (c Blockchain) Checkpoint(height int) (Checkpoint, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if height < 0 || height >= c.l.Len() {
+		return Checkpoint{}, errors.New("blockchain.Checkpoint: height " + strconv.Itoa(height) + " out of range")
+	}
+	e := c.l.Front()
+	for i := 0; i < height; i++ {
+		e = e.Next()
+	}
+	return Checkpoint{Height: height, Hash: e.Value.(*Block).Hash()}, nil
+}
+
+// ValidateFromCheckpoint is like Validate, but trusts every block up to and
+// including the checkpoint's, only checking that the block at its height
+// still has the recorded hash.
+func (c Blockchain) ValidateFromCheckpoint(cp Checkpoint) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if cp.Height < 0 || cp.Height >= c.l.Len() {
+		return errors.New("blockchain.ValidateFromCheckpoint: height " + strconv.Itoa(cp.Height) + " out of range")
+	}
+	e := c.l.Front()
+	for i := 0; i < cp.Height; i++ {
+		e = e.Next()
+	}
+	if !bytes.Equal(e.Value.(*Block).Hash(), cp.Hash) {
+		return invalid(cp.Height, "checkpoint", "hash does not match checkpoint")
+	}
+	return c.validateFrom(cp.Height + 1)
+}
@@ -0,0 +1,44 @@
+package blockchain_test
+
+import (
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestValidateFromCheckpoint(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	var corrupted *blockchain.Block
+	for i := 0; i < 5; i++ {
+		block := chain.NewBlock()
+		sendValue(t, block, me, you, 1)
+		block.Mine(difficulty)
+		if i == 1 {
+			corrupted = block
+		}
+	}
+
+	cp, err := chain.Checkpoint(3)
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %s", err)
+	}
+	corrupted.TamperSignature(0)
+
+	if chain.Valid() {
+		t.Error("chain with a corrupted block is valid")
+	}
+	if err := chain.ValidateFromCheckpoint(cp); err != nil {
+		t.Errorf("validation from checkpoint failed: %s", err)
+	}
+
+	other, err := chain.Checkpoint(2)
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %s", err)
+	}
+	if err := chain.ValidateFromCheckpoint(blockchain.Checkpoint{Height: 3, Hash: other.Hash}); err == nil {
+		t.Error("expected an error for a checkpoint with the wrong hash")
+	}
+}
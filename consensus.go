@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// Consensus decides how the blocks on a chain are proven. The chain asks it
+// to prove each block it creates, and accepts a block only if it validates.
+type Consensus interface {
+	// ProveBlock makes b valid, such as by mining it.
+	ProveBlock(b *Block) error
+	// ValidateBlock returns true if b has been proven.
+	ValidateBlock(b *Block) bool
+}
+
+// ProofOfWork is the default consensus, under which a block is proven by
+// mining it to its difficulty.
+type ProofOfWork struct{}
+
+// ProveBlock mines b at its current difficulty.
+func (ProofOfWork) ProveBlock(b *Block) error {
+	_, err := b.MineContext(context.Background())
+	return err
+}
+
+// ValidateBlock returns true if b's hash counts as proof-of-work at its
+// difficulty.
+func (ProofOfWork) ValidateBlock(b *Block) bool {
+	return meetsTarget(b.Hash(), difficultyTarget(b.difficulty))
+}
+
+// proofFailure describes a block that isn't proven under consensus, keeping
+// the wording errors have always used for proof-of-work.
+func proofFailure(consensus Consensus) string {
+	if _, ok := consensus.(ProofOfWork); ok {
+		return "invalid proof-of-work"
+	}
+	return "invalid proof"
+}
+
+// Validator is a participant in proof-of-stake consensus, whose chance of
+// proposing each block is proportional to its stake.
+type Validator struct {
+	PublicKey *ecdsa.PublicKey
+	Stake     uint64
+}
+
+// ProofOfStake is an experimental alternative to proof-of-work, under which
+// each block has a single proposer chosen deterministically from the
+// validators, weighted by stake. Instead of being mined, a block is proven by
+// its proposer signing it.
+type ProofOfStake struct {
+	validators []Validator
+	signers    []Identity
+}
+
+// NewProofOfStake returns proof-of-stake consensus among the given validators.
+// Blocks can only be proven when their proposer's identity is one of signers,
+// but any node can validate them.
+func NewProofOfStake(validators []Validator, signers ...Identity) ProofOfStake {
+	return ProofOfStake{validators: validators, signers: signers}
+}
+
+// Proposer returns the public key of the validator chosen to propose the block
+// following the one with hash prevHash, or nil if no validator has any stake.
+func (p ProofOfStake) Proposer(prevHash []byte) *ecdsa.PublicKey {
+	total := new(big.Int)
+	for _, v := range p.validators {
+		total.Add(total, new(big.Int).SetUint64(v.Stake))
+	}
+	if total.Sign() == 0 {
+		return nil
+	}
+	seed := sha256.Sum256(prevHash)
+	pick := new(big.Int).SetBytes(seed[:])
+	pick.Mod(pick, total)
+	for _, v := range p.validators {
+		stake := new(big.Int).SetUint64(v.Stake)
+		if pick.Cmp(stake) < 0 {
+			return v.PublicKey
+		}
+		pick.Sub(pick, stake)
+	}
+	return nil
+}
+
+// ProveBlock makes the block's proposer its miner, so that it collects the
+// block's fees, and signs the block's hash with the proposer's identity. It
+// returns an error if the proposer isn't one of the signers.
+func (p ProofOfStake) ProveBlock(b *Block) error {
+	proposer := p.Proposer(b.prevHash)
+	if proposer == nil {
+		return errors.New("blockchain.ProofOfStake.ProveBlock: no validator has any stake")
+	}
+	for _, signer := range p.signers {
+		if !signer.PublicKey().Equal(proposer) {
+			continue
+		}
+		b.miner = proposer
+		b.cachedHash = nil
+		b.commitMerkleRoot()
+		r, s, err := signer.signer.Sign(b.Hash())
+		if err != nil {
+			return errors.New("blockchain.ProofOfStake.ProveBlock: " + err.Error())
+		}
+		proof, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+		if err != nil {
+			return errors.New("blockchain.ProofOfStake.ProveBlock: " + err.Error())
+		}
+		b.proof = proof
+		return nil
+	}
+	return errors.New("blockchain.ProofOfStake.ProveBlock: not the block's proposer")
+}
+
+// ValidateBlock returns true if b's miner is its proposer and b carries the
+// proposer's signature over its hash.
+func (p ProofOfStake) ValidateBlock(b *Block) bool {
+	proposer := p.Proposer(b.prevHash)
+	if proposer == nil || !keysEqual(b.miner, proposer) {
+		return false
+	}
+	return ecdsa.VerifyASN1(proposer, b.Hash(), b.proof)
+}
@@ -0,0 +1,127 @@
+package blockchain_test
+
+import (
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestConsensus(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	validators := []blockchain.Validator{
+		{PublicKey: me.PublicKey(), Stake: 3},
+		{PublicKey: you.PublicKey(), Stake: 1},
+	}
+	pos := blockchain.NewProofOfStake(validators, me, you)
+
+	for _, c := range []struct {
+		name      string
+		consensus blockchain.Consensus
+		invalid   string
+	}{
+		{"proof-of-work", blockchain.ProofOfWork{}, "block 4: invalid proof-of-work"},
+		{"proof-of-stake", pos, "block 4: invalid proof"},
+	} {
+		chain := blockchain.NewChain(blockchain.WithDifficulty(4), blockchain.WithConsensus(c.consensus))
+		if _, err := chain.Genesis([]byte("genesis")); err != nil {
+			t.Fatalf("%s: failed to create genesis block: %s", c.name, err)
+		}
+		for _, data := range []string{"one", "two", "three"} {
+			chain.Add([]byte(data))
+		}
+		if err := chain.Validate(); err != nil {
+			t.Errorf("%s: chain is not valid: %s", c.name, err)
+		}
+		for block := range chain.Blocks() {
+			if !c.consensus.ValidateBlock(block) {
+				t.Errorf("%s: block %d does not validate", c.name, block.Height())
+			}
+		}
+
+		tip, _ := chain.Tip()
+		lazy := blockchain.NewBlock(tip.Hash(), []byte("lazy"))
+		if err := chain.AppendBlock(lazy); err != blockchain.ErrInsufficientWork {
+			t.Errorf("%s: AppendBlock error = %v, want %v", c.name, err, blockchain.ErrInsufficientWork)
+		}
+		// An unmined block could meet a low difficulty by chance.
+		chain.NewBlock().SetDifficulty(32)
+		if err := chain.Validate(); err == nil || err.Error() != c.invalid {
+			t.Errorf("%s: Validate error = %v, want %q", c.name, err, c.invalid)
+		}
+	}
+}
+
+func TestProofOfStake(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	validators := []blockchain.Validator{
+		{PublicKey: me.PublicKey(), Stake: 1},
+		{PublicKey: you.PublicKey(), Stake: 1},
+	}
+	pos := blockchain.NewProofOfStake(validators, me, you)
+	chain := blockchain.NewChain(blockchain.WithConsensus(pos))
+	for i := 0; i < 16; i++ {
+		chain.Add(nil)
+	}
+	proposed := make(map[string]int)
+	for block := range chain.Blocks() {
+		if want := pos.Proposer(block.PrevHash()); !block.Miner().Equal(want) {
+			t.Errorf("block %d was proven by someone other than its proposer", block.Height())
+		}
+		proposed[string(block.Miner().X.Bytes())]++
+	}
+	if len(proposed) != 2 {
+		t.Errorf("%d validators proposed blocks, want both", len(proposed))
+	}
+
+	// Without the proposer's identity, a block can't be proven, though it can
+	// still be validated.
+	tip, _ := chain.Tip()
+	var signer blockchain.Identity
+	if pos.Proposer(tip.Hash()).Equal(me.PublicKey()) {
+		signer = you
+	} else {
+		signer = me
+	}
+	block := blockchain.NewBlock(tip.Hash(), nil)
+	if err := blockchain.NewProofOfStake(validators, signer).ProveBlock(block); err == nil {
+		t.Error("expected an error proving a block without the proposer's identity")
+	}
+	if err := pos.ProveBlock(block); err != nil {
+		t.Fatalf("failed to prove block: %s", err)
+	}
+	if !blockchain.NewProofOfStake(validators).ValidateBlock(block) {
+		t.Error("block does not validate without any signers")
+	}
+
+	if err := blockchain.NewProofOfStake(nil, me).ProveBlock(block); err == nil {
+		t.Error("expected an error proving a block without any stake")
+	}
+}
+
+func TestAddUnproven(t *testing.T) {
+	me := mustIdentity(blockchain.NewIdentity())
+	validators := []blockchain.Validator{{PublicKey: me.PublicKey(), Stake: 1}}
+	chain := blockchain.NewChain(blockchain.WithConsensus(blockchain.NewProofOfStake(validators)))
+
+	if block := chain.Add([]byte("unproven")); block != nil {
+		t.Error("Add returned a block that can't be proven")
+	}
+
+	var pool blockchain.Mempool
+	tx, err := blockchain.NewValueTransaction(me, me.PublicKey(), 1, []byte("waiting"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	if block := chain.MineBlock(&pool, 1); block != nil {
+		t.Error("MineBlock returned a block that can't be proven")
+	}
+	if got := len(pool.Pending()); got != 1 {
+		t.Errorf("pool has %d pending transactions, want 1", got)
+	}
+	if chain.Len() != 0 {
+		t.Errorf("chain has %d blocks, want none", chain.Len())
+	}
+}
@@ -0,0 +1,745 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// chainWire is the serialized form of a Blockchain.
+type chainWire struct {
+	HashVersion    int
+	Difficulty     int
+	TargetInterval time.Duration
+	Window         int
+	MaxTxPerBlock  int
+	MaxBlockSize   int
+	MaxFutureDrift time.Duration
+	// Hasher is the hash of no data under the chain's hash function, which
+	// identifies the function so that the chain isn't decoded with another.
+	Hasher []byte
+	Blocks []blockWire
+}
+
+// blockWire is the serialized form of a Block.
+type blockWire struct {
+	PrevHash     []byte
+	Timestamp    time.Time
+	Nonce        uint32
+	Difficulty   int
+	Data         []byte
+	Meta         map[string]string
+	Miner        []byte
+	MerkleRoot   []byte
+	PrunedHash   []byte
+	MinedHash    []byte
+	Proof        []byte
+	Alloc        []allocationWire
+	Transactions []transactionWire
+}
+
+// allocationWire is the serialized form of a genesis block's allocation, with
+// the public key in its PKIX, ASN.1 DER form.
+type allocationWire struct {
+	Key    []byte
+	Amount uint64
+}
+
+// transactionWire is the serialized form of a Transaction. Public keys are
+// stored in their PKIX, ASN.1 DER form. The sender is left empty when it can
+// be recovered from the signature.
+type transactionWire struct {
+	Kind             TxKind
+	Sender, Receiver []byte
+	Amount, Fee      uint64
+	Timestamp        int64
+	Data, Random     []byte
+	Sig1, Sig2       *big.Int
+	RecoveryID       byte
+	Outputs          []outputWire
+}
+
+// outputWire is the serialized form of an Output, with the receiver's public
+// key in its PKIX, ASN.1 DER form.
+type outputWire struct {
+	Receiver []byte
+	Amount   uint64
+}
+
+// Encode writes the entire chain to w using encoding/gob.
+func (c Blockchain) Encode(w io.Writer) error {
+	wire := c.wireHeader()
+	for _, block := range c.blocks() {
+		wire.Blocks = append(wire.Blocks, block.wire())
+	}
+	if err := gob.NewEncoder(w).Encode(wire); err != nil {
+		return errors.New("blockchain.Encode: " + err.Error())
+	}
+	return nil
+}
+
+// Decode reads a chain previously written by Encode. The chain must use
+// SHA-256; use DecodeWithHasher for one that doesn't.
+func Decode(r io.Reader) (Blockchain, error) {
+	return DecodeWithHasher(r, nil)
+}
+
+// DecodeWithHasher is like Decode, but for a chain using the hash function
+// returned by newHash, as created by NewChainWithHasher. It returns an error
+// if the chain was encoded with a different one.
+func DecodeWithHasher(r io.Reader, newHash func() hash.Hash) (Blockchain, error) {
+	var wire chainWire
+	if err := gob.NewDecoder(r).Decode(&wire); err != nil {
+		return Blockchain{}, errors.New("blockchain.Decode: " + err.Error())
+	}
+	c, err := wire.chain(newHash)
+	if err != nil {
+		return Blockchain{}, errors.New("blockchain.Decode: " + err.Error())
+	}
+	for _, bw := range wire.Blocks {
+		block, err := bw.block()
+		if err != nil {
+			return Blockchain{}, errors.New("blockchain.Decode: " + err.Error())
+		}
+		block.setHasher(newHash)
+		c.push(block)
+	}
+	return c, nil
+}
+
+// VerifyStored checks that each of the chain's blocks is still proven, which
+// is meant for a chain that was just decoded, in case it was corrupted or
+// tampered with while stored. Each block's hash is recomputed from its
+// contents, which must match the hash it was mined with if that's known,
+// either because it was mined in memory or because it was stored along with
+// the block, and be proven at the difficulty required at its height. Pruned
+// blocks can't be rehashed, so they're skipped. Unlike Validate, nothing else
+// is checked. The error is a *ValidationError.
+func (c Blockchain) VerifyStored() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	difficulty := c.difficulty
+	height := 0
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		block := e.Value.(*Block)
+		if !block.Pruned() {
+			hash := block.Header().Hash()
+			for _, mined := range [][]byte{block.cachedHash, block.storedHash} {
+				if mined != nil && !bytes.Equal(hash, mined) {
+					return invalid(height, "hash", "hash does not match the hash it was mined with")
+				}
+			}
+			if block.difficulty < difficulty || !c.consensus.ValidateBlock(block) {
+				return invalid(height, "proof", proofFailure(c.consensus))
+			}
+		}
+		difficulty = c.retarget(e, difficulty)
+		height++
+	}
+	return nil
+}
+
+// WriteTo implements io.WriterTo, writing the chain to w as a stream of
+// frames: one holding the chain's configuration, one for each block, and an
+// empty frame marking the end. Each frame is a gob-encoded value prefixed by
+// its length as a 4-byte big-endian integer, and may be at most 64 MiB.
+// Unlike Encode, the chain never has to be held in memory all at once.
+func (c Blockchain) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if err := writeFrame(cw, c.wireHeader()); err != nil {
+		return cw.n, errors.New("blockchain.WriteTo: " + err.Error())
+	}
+	for _, block := range c.blocks() {
+		if err := writeFrame(cw, block.wire()); err != nil {
+			return cw.n, errors.New("blockchain.WriteTo: " + err.Error())
+		}
+	}
+	if _, err := cw.Write(make([]byte, 4)); err != nil {
+		return cw.n, errors.New("blockchain.WriteTo: " + err.Error())
+	}
+	return cw.n, nil
+}
+
+// ReadFrom implements io.ReaderFrom, replacing the chain with one written by
+// WriteTo. It stops reading at the end of the chain, so r may hold more data.
+// The chain read must use the same hash function as c, so one using anything
+// but SHA-256 must be read into a chain created by NewChainWithHasher. The
+// configuration written by WriteTo replaces c's, but anything else, such as
+// its consensus, is kept, and c's subscribers receive each block read. The
+// zero Blockchain may be read into, taking the default configuration.
+func (c *Blockchain) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	var wire chainWire
+	if ok, err := readFrame(cr, &wire); !ok || err != nil {
+		if err == nil {
+			err = errors.New("missing chain header")
+		}
+		return cr.n, errors.New("blockchain.ReadFrom: " + err.Error())
+	}
+	chain, err := wire.chain(c.newHash)
+	if err != nil {
+		return cr.n, errors.New("blockchain.ReadFrom: " + err.Error())
+	}
+	var blocks []*Block
+	for {
+		var bw blockWire
+		ok, err := readFrame(cr, &bw)
+		if err != nil {
+			return cr.n, errors.New("blockchain.ReadFrom: " + err.Error())
+		}
+		if !ok {
+			break
+		}
+		block, err := bw.block()
+		if err != nil {
+			return cr.n, errors.New("blockchain.ReadFrom: " + err.Error())
+		}
+		block.setHasher(chain.newHash)
+		blocks = append(blocks, block)
+	}
+
+	if c.mu == nil {
+		*c = chain
+	} else {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.setDifficulty(chain.difficulty)
+		c.targetInterval, c.window = chain.targetInterval, chain.window
+		c.maxTxPerBlock, c.maxBlockSize = chain.maxTxPerBlock, chain.maxBlockSize
+		c.maxFutureDrift = chain.maxFutureDrift
+		c.l.Init()
+	}
+	for _, block := range blocks {
+		c.push(block)
+	}
+	c.utxo.reset()
+	c.updateUTXO()
+	c.index.reset()
+	c.index.update(*c)
+	return cr.n, nil
+}
+
+// wireHeader returns the serialized form of the chain's configuration,
+// without any of its blocks.
+func (c Blockchain) wireHeader() chainWire {
+	return chainWire{
+		HashVersion:    hashVersion,
+		Difficulty:     c.difficulty,
+		TargetInterval: c.targetInterval,
+		Window:         c.window,
+		MaxTxPerBlock:  c.maxTxPerBlock,
+		MaxBlockSize:   c.maxBlockSize,
+		MaxFutureDrift: c.maxFutureDrift,
+		Hasher:         newHasher(c.newHash).Sum(nil),
+	}
+}
+
+// chain returns an empty chain with the configuration in wire, ignoring its
+// blocks, that uses the hash function returned by newHash, or SHA-256 if
+// newHash is nil. It returns an error if wire was encoded with a different
+// hash function.
+func (wire chainWire) chain(newHash func() hash.Hash) (Blockchain, error) {
+	if wire.HashVersion != hashVersion {
+		return Blockchain{}, errors.New("unsupported hash version " + strconv.Itoa(wire.HashVersion))
+	}
+	if !bytes.Equal(wire.Hasher, newHasher(newHash).Sum(nil)) {
+		return Blockchain{}, errors.New("chain was encoded with a different hash function")
+	}
+	return NewChain(
+		WithHasher(newHash),
+		WithDifficulty(wire.Difficulty),
+		WithTargetInterval(wire.TargetInterval),
+		WithRetargetWindow(wire.Window),
+		WithMaxTxPerBlock(wire.MaxTxPerBlock),
+		WithMaxBlockSize(wire.MaxBlockSize),
+		WithMaxFutureDrift(wire.MaxFutureDrift),
+	), nil
+}
+
+// maxFrameSize limits the length of each frame written by WriteTo, so that
+// ReadFrom doesn't trust a length read from the stream to allocate memory.
+const maxFrameSize = 64 << 20
+
+// writeFrame writes v to w gob-encoded, prefixed by its length.
+func writeFrame(w io.Writer, v any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	if buf.Len() > maxFrameSize {
+		return errors.New("frame of " + strconv.Itoa(buf.Len()) + " bytes exceeds the maximum of " + strconv.Itoa(maxFrameSize))
+	}
+	_, err := w.Write(appendBytes(nil, buf.Bytes()))
+	return err
+}
+
+// readFrame reads a frame written by writeFrame into v. It returns false if
+// the frame is empty, marking the end of the stream.
+func readFrame(r io.Reader, v any) (bool, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return false, err
+	}
+	n := binary.BigEndian.Uint32(length)
+	if n == 0 {
+		return false, nil
+	}
+	if n > maxFrameSize {
+		return false, errors.New("frame of " + strconv.FormatUint(uint64(n), 10) + " bytes exceeds the maximum of " + strconv.Itoa(maxFrameSize))
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return false, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(frame)).Decode(v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (b Block) wire() blockWire {
+	bw := blockWire{
+		PrevHash:   b.prevHash,
+		Timestamp:  b.timestamp,
+		Nonce:      b.nonce,
+		Difficulty: b.difficulty,
+		Data:       b.data,
+		Meta:       b.meta,
+		MerkleRoot: b.merkleRoot,
+		PrunedHash: b.prunedHash,
+		MinedHash:  b.cachedHash,
+		Proof:      b.proof,
+	}
+	if bw.MinedHash == nil {
+		bw.MinedHash = b.storedHash
+	}
+	if b.miner != nil {
+		bw.Miner = mustBinary(x509.MarshalPKIXPublicKey(b.miner))
+	}
+	for _, a := range b.alloc {
+		bw.Alloc = append(bw.Alloc, allocationWire{Key: mustBinary(x509.MarshalPKIXPublicKey(a.key)), Amount: a.amount})
+	}
+	for _, t := range b.transactions {
+		bw.Transactions = append(bw.Transactions, t.wire())
+	}
+	return bw
+}
+
+func (bw blockWire) block() (*Block, error) {
+	b := &Block{
+		prevHash:   bw.PrevHash,
+		timestamp:  bw.Timestamp,
+		nonce:      bw.Nonce,
+		difficulty: bw.Difficulty,
+		data:       bw.Data,
+		meta:       bw.Meta,
+		merkleRoot: bw.MerkleRoot,
+		prunedHash: bw.PrunedHash,
+		storedHash: bw.MinedHash,
+		proof:      bw.Proof,
+	}
+	if len(bw.Miner) > 0 {
+		miner, err := parsePublicKey(bw.Miner)
+		if err != nil {
+			return nil, errors.New("invalid miner: " + err.Error())
+		}
+		b.miner = miner
+	}
+	for _, aw := range bw.Alloc {
+		key, err := parsePublicKey(aw.Key)
+		if err != nil {
+			return nil, errors.New("invalid allocation: " + err.Error())
+		}
+		b.alloc = append(b.alloc, allocation{key: key, amount: aw.Amount})
+	}
+	for _, tw := range bw.Transactions {
+		t, err := tw.transaction()
+		if err != nil {
+			return nil, err
+		}
+		b.transactions = append(b.transactions, t)
+	}
+	return b, nil
+}
+
+func (t Transaction) wire() transactionWire {
+	tw := transactionWire{
+		Kind:       t.kind,
+		Receiver:   mustBinary(x509.MarshalPKIXPublicKey(t.receiver)),
+		Amount:     t.amount,
+		Fee:        t.fee,
+		Timestamp:  t.timestamp.UnixNano(),
+		Data:       t.data,
+		Random:     t.random,
+		Sig1:       t.sig1,
+		Sig2:       t.sig2,
+		RecoveryID: t.recoveryID,
+	}
+	if !t.senderRecoverable() {
+		tw.Sender = mustBinary(x509.MarshalPKIXPublicKey(t.sender))
+	}
+	for _, o := range t.outputs {
+		tw.Outputs = append(tw.Outputs, outputWire{
+			Receiver: mustBinary(x509.MarshalPKIXPublicKey(o.Receiver)),
+			Amount:   o.Amount,
+		})
+	}
+	return tw
+}
+
+// transaction returns the transaction tw is the serialized form of. If the
+// sender was left out but can't be recovered, it's left nil, and the
+// transaction won't verify.
+func (tw transactionWire) transaction() (Transaction, error) {
+	receiver, err := parsePublicKey(tw.Receiver)
+	if err != nil {
+		return Transaction{}, errors.New("invalid receiver: " + err.Error())
+	}
+	t := Transaction{
+		kind:       tw.Kind,
+		receiver:   receiver,
+		amount:     tw.Amount,
+		fee:        tw.Fee,
+		timestamp:  time.Unix(0, tw.Timestamp),
+		data:       tw.Data,
+		random:     tw.Random,
+		sig1:       tw.Sig1,
+		sig2:       tw.Sig2,
+		recoveryID: tw.RecoveryID,
+	}
+	for _, ow := range tw.Outputs {
+		receiver, err := parsePublicKey(ow.Receiver)
+		if err != nil {
+			return Transaction{}, errors.New("invalid output receiver: " + err.Error())
+		}
+		t.outputs = append(t.outputs, Output{Receiver: receiver, Amount: ow.Amount})
+	}
+	if len(tw.Sender) == 0 {
+		t.sender, _ = t.recoverSender()
+		return t, nil
+	}
+	if t.sender, err = parsePublicKey(tw.Sender); err != nil {
+		return Transaction{}, errors.New("invalid sender: " + err.Error())
+	}
+	return t, nil
+}
+
+// parsePublicKey parses a PKIX, ASN.1 DER encoded ECDSA public key.
+func parsePublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA public key")
+	}
+	return pub, nil
+}
+
+// MarshalJSON implements json.Marshaler. The resulting object has the
+// following fields:
+//
+//	hash          hex-encoded block hash
+//	prevHash      hex-encoded hash of the previous block
+//	timestamp     RFC 3339 timestamp
+//	nonce         nonce found by mining
+//	difficulty    mining difficulty
+//	data          base64-encoded block data
+//	meta          object holding the block's metadata
+//	miner         hex-encoded PKIX public key of the miner, empty if none
+//	transactions  array of transactions, see Transaction.MarshalJSON
+func (b Block) MarshalJSON() ([]byte, error) {
+	transactions := b.transactions
+	if transactions == nil {
+		transactions = []Transaction{}
+	}
+	meta := b.meta
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	var miner string
+	if b.miner != nil {
+		miner = hex.EncodeToString(mustBinary(x509.MarshalPKIXPublicKey(b.miner)))
+	}
+	return json.Marshal(struct {
+		Hash         string            `json:"hash"`
+		PrevHash     string            `json:"prevHash"`
+		Timestamp    string            `json:"timestamp"`
+		Nonce        uint32            `json:"nonce"`
+		Difficulty   int               `json:"difficulty"`
+		Data         []byte            `json:"data"`
+		Meta         map[string]string `json:"meta"`
+		Miner        string            `json:"miner"`
+		Transactions []Transaction     `json:"transactions"`
+	}{
+		Hash:         b.HashString(),
+		PrevHash:     hex.EncodeToString(b.prevHash),
+		Timestamp:    b.timestamp.Format(time.RFC3339Nano),
+		Nonce:        b.nonce,
+		Difficulty:   b.difficulty,
+		Data:         b.data,
+		Meta:         meta,
+		Miner:        miner,
+		Transactions: transactions,
+	})
+}
+
+// MarshalJSON implements json.Marshaler. The resulting object has the
+// following fields:
+//
+//	kind      kind of transaction: "transfer", "message", or "contract"
+//	sender    hex-encoded PKIX public key of the sender
+//	receiver  hex-encoded PKIX public key of the receiver
+//	amount    value transferred
+//	fee       fee paid to the miner
+//	timestamp RFC 3339 timestamp
+//	data      base64-encoded transaction data
+//	sig1      hex-encoded r component of the signature, empty if unsigned
+//	sig2      hex-encoded s component of the signature, empty if unsigned
+//	outputs   array of objects with a hex-encoded PKIX receiver and an amount,
+//	          only present for transactions with multiple recipients
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	sender, err := t.SenderErr()
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := t.ReceiverErr()
+	if err != nil {
+		return nil, err
+	}
+	type outputJSON struct {
+		Receiver string `json:"receiver"`
+		Amount   uint64 `json:"amount"`
+	}
+	var outputs []outputJSON
+	for _, o := range t.outputs {
+		der, err := x509.MarshalPKIXPublicKey(o.Receiver)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, outputJSON{Receiver: hex.EncodeToString(der), Amount: o.Amount})
+	}
+	return json.Marshal(struct {
+		Kind      string       `json:"kind"`
+		Sender    string       `json:"sender"`
+		Receiver  string       `json:"receiver"`
+		Amount    uint64       `json:"amount"`
+		Fee       uint64       `json:"fee"`
+		Timestamp string       `json:"timestamp"`
+		Data      []byte       `json:"data"`
+		Sig1      string       `json:"sig1"`
+		Sig2      string       `json:"sig2"`
+		Outputs   []outputJSON `json:"outputs,omitempty"`
+	}{
+		Kind:      t.kind.String(),
+		Sender:    sender,
+		Receiver:  receiver,
+		Amount:    t.amount,
+		Fee:       t.fee,
+		Timestamp: t.timestamp.UTC().Format(time.RFC3339Nano),
+		Data:      t.data,
+		Sig1:      hexInt(t.sig1),
+		Sig2:      hexInt(t.sig2),
+		Outputs:   outputs,
+	})
+}
+
+// hexInt returns the hex encoding of i, or an empty string if i is nil.
+func hexInt(i *big.Int) string {
+	if i == nil {
+		return ""
+	}
+	return i.Text(16)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding consists of
+// the kind as a single byte, the sender and receiver public keys in PKIX form,
+// the amount and fee, the timestamp in Unix nanoseconds, the data, the random
+// bytes, the two signature components, and the recovery id as a single byte,
+// in that order. A transaction with multiple recipients is followed by the
+// number of outputs as a 4-byte integer and then each output's receiver in
+// PKIX form and amount. Integers are fixed-width big-endian and everything
+// else is prefixed by its length as a 4-byte big-endian integer. The sender is
+// left empty when it can be recovered from the signature.
+func (t Transaction) MarshalBinary() ([]byte, error) {
+	var sender []byte
+	if !t.senderRecoverable() {
+		var err error
+		if sender, err = x509.MarshalPKIXPublicKey(t.sender); err != nil {
+			return nil, errors.New("blockchain.Transaction.MarshalBinary: invalid sender: " + err.Error())
+		}
+	}
+	receiver, err := x509.MarshalPKIXPublicKey(t.receiver)
+	if err != nil {
+		return nil, errors.New("blockchain.Transaction.MarshalBinary: invalid receiver: " + err.Error())
+	}
+
+	buf := []byte{byte(t.kind)}
+	buf = appendBytes(buf, sender)
+	buf = appendBytes(buf, receiver)
+	buf = binary.BigEndian.AppendUint64(buf, t.amount)
+	buf = binary.BigEndian.AppendUint64(buf, t.fee)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(t.timestamp.UnixNano()))
+	buf = appendBytes(buf, t.data)
+	buf = appendBytes(buf, t.random)
+	buf = appendBytes(buf, intBytes(t.sig1))
+	buf = appendBytes(buf, intBytes(t.sig2))
+	buf = append(buf, t.recoveryID)
+	if len(t.outputs) > 0 {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(t.outputs)))
+		if buf, err = t.appendOutputs(buf, binary.BigEndian); err != nil {
+			return nil, errors.New("blockchain.Transaction.MarshalBinary: " + err.Error())
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalTransaction parses a transaction encoded with MarshalBinary.
+func UnmarshalTransaction(data []byte) (Transaction, error) {
+	r := binaryReader{buf: data}
+	tw := transactionWire{
+		Kind:       TxKind(r.uint8()),
+		Sender:     r.bytes(),
+		Receiver:   r.bytes(),
+		Amount:     r.uint64(),
+		Fee:        r.uint64(),
+		Timestamp:  int64(r.uint64()),
+		Data:       r.bytes(),
+		Random:     r.bytes(),
+		Sig1:       bytesInt(r.bytes()),
+		Sig2:       bytesInt(r.bytes()),
+		RecoveryID: r.uint8(),
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			tw.Outputs = append(tw.Outputs, outputWire{Receiver: r.bytes(), Amount: r.uint64()})
+		}
+	}
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err != nil {
+		return Transaction{}, errors.New("blockchain.UnmarshalTransaction: " + r.err.Error())
+	}
+	t, err := tw.transaction()
+	if err != nil {
+		return Transaction{}, errors.New("blockchain.UnmarshalTransaction: " + err.Error())
+	}
+	return t, nil
+}
+
+// appendBytes appends b to buf, prefixed by its length.
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+// intBytes returns the big-endian bytes of i, or nil if i is nil.
+func intBytes(i *big.Int) []byte {
+	if i == nil {
+		return nil
+	}
+	return i.Bytes()
+}
+
+// bytesInt is the inverse of intBytes.
+func bytesInt(b []byte) *big.Int {
+	if len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+// binaryReader reads values written by appendBytes and
+// binary.BigEndian.AppendUint64. Once a read fails, err is set and all
+// further reads return zero values.
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.err = errors.New("unexpected end of data")
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *binaryReader) bytes() []byte {
+	length := r.next(4)
+	if length == nil {
+		return nil
+	}
+	b := r.next(int(binary.BigEndian.Uint32(length)))
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (r *binaryReader) uint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *binaryReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *binaryReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,318 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	const difficulty = 2
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	for _, msg := range []string{"one", "two", "three"} {
+		block := chain.NewBlock()
+		if err := block.SendTransaction(me, you.PublicKey(), []byte(msg)); err != nil {
+			t.Fatalf("failed to send transaction: %s", err)
+		}
+		block.Mine(difficulty)
+	}
+
+	var buf bytes.Buffer
+	if err := chain.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode chain: %s", err)
+	}
+	decoded, err := blockchain.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode chain: %s", err)
+	}
+
+	if !decoded.Valid() {
+		t.Error("decoded blockchain is not valid")
+	}
+	if got, want := blockHashes(decoded), blockHashes(chain); !equalStrings(got, want) {
+		t.Errorf("decoded hashes = %v, want %v", got, want)
+	}
+}
+
+func TestVerifyStored(t *testing.T) {
+	const difficulty = 8
+
+	chain := blockchain.New(difficulty)
+	for _, data := range []string{"one", "two", "three"} {
+		chain.Add([]byte(data))
+	}
+	decode := func() blockchain.Blockchain {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := chain.Encode(&buf); err != nil {
+			t.Fatalf("failed to encode chain: %s", err)
+		}
+		decoded, err := blockchain.Decode(&buf)
+		if err != nil {
+			t.Fatalf("failed to decode chain: %s", err)
+		}
+		return decoded
+	}
+
+	if err := decode().VerifyStored(); err != nil {
+		t.Errorf("decoded chain does not verify: %s", err)
+	}
+
+	// Corrupt a nonce so that the block is no longer proven.
+	block, _ := chain.GetBlock(1)
+	for blockchain.VerifyBlockPoW(block, difficulty) {
+		block.SetNonce(block.Nonce() + 1)
+	}
+	var verr *blockchain.ValidationError
+	if err := decode().VerifyStored(); !errors.As(err, &verr) || verr.Height != 1 || verr.Rule != "proof" {
+		t.Errorf("VerifyStored error = %v, want an invalid proof at height 1", err)
+	}
+
+	// A block whose contents no longer match the hash it was mined with.
+	block.Mine(difficulty)
+	block.SetCachedHash(make([]byte, 32))
+	if err := chain.VerifyStored(); !errors.As(err, &verr) || verr.Height != 1 || verr.Rule != "hash" {
+		t.Errorf("VerifyStored error = %v, want a hash mismatch at height 1", err)
+	}
+
+	// The mined hash is stored along with the block, so the mismatch is
+	// still caught once decoded, without the decoded block trusting it.
+	decoded := decode()
+	if err := decoded.VerifyStored(); !errors.As(err, &verr) || verr.Height != 1 || verr.Rule != "hash" {
+		t.Errorf("VerifyStored error after decoding = %v, want a hash mismatch at height 1", err)
+	}
+	got, _ := decoded.GetBlock(1)
+	if !bytes.Equal(got.Hash(), got.Header().Hash()) {
+		t.Error("decoded block uses its stored hash as its hash")
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	const difficulty = 2
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	for _, msg := range []string{"one", "two", "three"} {
+		block := chain.NewBlock()
+		if err := block.SendTransaction(me, you.PublicKey(), []byte(msg)); err != nil {
+			t.Fatalf("failed to send transaction: %s", err)
+		}
+		block.Mine(difficulty)
+	}
+	if !chain.Valid() {
+		t.Fatal("chain is not valid")
+	}
+
+	var buf bytes.Buffer
+	written, err := chain.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("failed to write chain: %s", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, but wrote %d", written, buf.Len())
+	}
+	buf.WriteString("trailing data")
+
+	var decoded blockchain.Blockchain
+	read, err := decoded.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("failed to read chain: %s", err)
+	}
+	if read != written {
+		t.Errorf("ReadFrom reported %d bytes, want %d", read, written)
+	}
+	if buf.String() != "trailing data" {
+		t.Errorf("ReadFrom consumed data after the chain, leaving %q", buf.String())
+	}
+	if !decoded.Valid() {
+		t.Error("decoded blockchain is not valid")
+	}
+	if got, want := blockHashes(decoded), blockHashes(chain); !equalStrings(got, want) {
+		t.Errorf("decoded hashes = %v, want %v", got, want)
+	}
+}
+
+func TestReadFromExisting(t *testing.T) {
+	chain := chainOfLength(3)
+	var buf bytes.Buffer
+	if _, err := chain.WriteTo(&buf); err != nil {
+		t.Fatalf("failed to write chain: %s", err)
+	}
+
+	// Reading into a chain keeps its subscribers, and any copies of it see
+	// the blocks read.
+	decoded := blockchain.New(0)
+	alias := decoded
+	blocks, unsubscribe := decoded.Subscribe()
+	defer unsubscribe()
+	if _, err := decoded.ReadFrom(&buf); err != nil {
+		t.Fatalf("failed to read chain: %s", err)
+	}
+	for i := 0; i < chain.Len(); i++ {
+		if block := <-blocks; block.Height() != i {
+			t.Errorf("subscriber received block %d, want %d", block.Height(), i)
+		}
+	}
+	if got, want := blockHashes(alias), blockHashes(chain); !equalStrings(got, want) {
+		t.Errorf("hashes seen by a copy = %v, want %v", got, want)
+	}
+	if !decoded.Valid() {
+		t.Error("decoded blockchain is not valid")
+	}
+}
+
+func TestReadFromOversizedFrame(t *testing.T) {
+	var decoded blockchain.Blockchain
+	_, err := decoded.ReadFrom(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Errorf("ReadFrom error = %v, want one for a frame longer than the maximum", err)
+	}
+}
+
+func TestWriteToReadFromGzip(t *testing.T) {
+	chain := chainOfLength(3)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := chain.WriteTo(zw); err != nil {
+		t.Fatalf("failed to write chain: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %s", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("failed to open gzip reader: %s", err)
+	}
+	var decoded blockchain.Blockchain
+	if _, err := decoded.ReadFrom(zr); err != nil {
+		t.Fatalf("failed to read chain: %s", err)
+	}
+	if !decoded.Valid() {
+		t.Error("decoded blockchain is not valid")
+	}
+	if got, want := blockHashes(decoded), blockHashes(chain); !equalStrings(got, want) {
+		t.Errorf("decoded hashes = %v, want %v", got, want)
+	}
+}
+
+func TestBlockMarshalJSON(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("hello json")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	hash := block.Mine(difficulty)
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("failed to marshal block: %s", err)
+	}
+
+	var parsed struct {
+		Hash         string `json:"hash"`
+		Transactions []struct {
+			Sender string `json:"sender"`
+			Data   []byte `json:"data"`
+			Sig1   string `json:"sig1"`
+		} `json:"transactions"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to parse block json: %s", err)
+	}
+	if parsed.Hash != hash {
+		t.Errorf("hash = %q, want %q", parsed.Hash, hash)
+	}
+	if len(parsed.Transactions) != 1 {
+		t.Fatalf("got %d transactions, want 1", len(parsed.Transactions))
+	}
+	tx := parsed.Transactions[0]
+	if tx.Sender != block.Transactions()[0].Sender() {
+		t.Errorf("sender = %q, want %q", tx.Sender, block.Transactions()[0].Sender())
+	}
+	if string(tx.Data) != "hello json" {
+		t.Errorf("data = %q, want %q", tx.Data, "hello json")
+	}
+	if tx.Sig1 == "" {
+		t.Error("expected a signature component")
+	}
+}
+
+func TestTransactionMarshalBinary(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), 42, 3, []byte("over the wire"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+	decoded, err := blockchain.UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal transaction: %s", err)
+	}
+
+	if !decoded.Verify() {
+		t.Error("decoded transaction does not verify")
+	}
+	if !bytes.Equal(decoded.Hash(), tx.Hash()) {
+		t.Error("decoded transaction has a different hash")
+	}
+	if decoded.Amount() != 42 || decoded.Fee() != 3 || string(decoded.Data()) != "over the wire" {
+		t.Errorf("decoded transaction has amount %d, fee %d, data %q", decoded.Amount(), decoded.Fee(), decoded.Data())
+	}
+}
+
+func TestUnmarshalTransactionTruncated(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte("cut short"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+
+	for _, n := range []int{0, 3, 10, len(data) / 2, len(data) - 1} {
+		if _, err := blockchain.UnmarshalTransaction(data[:n]); err == nil {
+			t.Errorf("expected an error unmarshaling %d of %d bytes", n, len(data))
+		}
+	}
+	if _, err := blockchain.UnmarshalTransaction(append(data, 0)); err == nil {
+		t.Error("expected an error for trailing data")
+	}
+}
+
+func blockHashes(chain blockchain.Blockchain) []string {
+	var hashes []string
+	chain.ForEach(func(block *blockchain.Block) {
+		hashes = append(hashes, block.HashString())
+	})
+	return hashes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"time"
+)
+
+// MineReportInterval exposes mineReportInterval to tests.
+const MineReportInterval = mineReportInterval
+
+// TamperSignature corrupts the signature of the i'th transaction in the
+// block, for testing validation.
+func (b *Block) TamperSignature(i int) {
+	t := &b.transactions[i]
+	t.sig1 = new(big.Int).Add(t.sig1, big.NewInt(1))
+	b.cachedHash = nil
+}
+
+// SetTransaction replaces the i'th transaction in the block without checking
+// it, for testing validation.
+func (b *Block) SetTransaction(i int, t Transaction) {
+	b.transactions[i] = t
+	b.cachedHash = nil
+}
+
+// SetFee changes the fee of the transaction without re-signing it.
+func (t *Transaction) SetFee(fee uint64) {
+	t.fee = fee
+}
+
+// SetRandom changes the random bytes of the transaction without re-signing
+// it.
+func (t *Transaction) SetRandom(random []byte) {
+	t.random = random
+}
+
+// SetKind changes the kind of the transaction without re-signing it.
+func (t *Transaction) SetKind(kind TxKind) {
+	t.kind = kind
+}
+
+// SetTimestamp changes the timestamp of the transaction without re-signing it.
+func (t *Transaction) SetTimestamp(timestamp time.Time) {
+	t.timestamp = timestamp
+}
+
+// SetDifficulty changes the difficulty of the block without mining it.
+func (b *Block) SetDifficulty(difficulty int) {
+	b.difficulty = difficulty
+	b.cachedHash = nil
+}
+
+// SetDifficulty changes the difficulty of the chain, as if it had been
+// constructed with it.
+func (c *Blockchain) SetDifficulty(difficulty int) {
+	c.setDifficulty(difficulty)
+}
+
+// SetPrevHash changes the previous hash of the block without mining it.
+func (b *Block) SetPrevHash(prevHash []byte) {
+	b.prevHash = prevHash
+	b.cachedHash = nil
+}
+
+// SetTimestamp changes the timestamp of the block without mining it.
+func (b *Block) SetTimestamp(timestamp time.Time) {
+	b.timestamp = timestamp
+	b.cachedHash = nil
+}
+
+// SetTransactionData changes the data of the i'th transaction in the block
+// without re-signing it.
+func (b *Block) SetTransactionData(i int, data []byte) {
+	b.transactions[i].data = data
+	b.cachedHash = nil
+}
+
+// SetNonce changes the nonce of the block without mining it.
+func (b *Block) SetNonce(nonce uint32) {
+	b.nonce = nonce
+	b.cachedHash = nil
+}
+
+// SetAllocation changes the balance the block allocates to its i'th key
+// without mining it.
+func (b *Block) SetAllocation(i int, amount uint64) {
+	b.alloc[i].amount = amount
+	b.cachedHash = nil
+}
+
+// SetSender changes the sender of the transaction without re-signing it.
+func (t *Transaction) SetSender(sender *ecdsa.PublicKey) {
+	t.sender = sender
+}
+
+// SetRawSignature changes the signature of the transaction without putting it
+// in canonical form.
+func (t *Transaction) SetRawSignature(r, s *big.Int) {
+	t.sig1, t.sig2 = r, s
+}
+
+// CachedHash returns the hash cached by mining the block, or nil if there
+// isn't one.
+func (b Block) CachedHash() []byte {
+	return b.cachedHash
+}
+
+// SetCachedHash changes the hash cached by mining the block without changing
+// the block.
+func (b *Block) SetCachedHash(hash []byte) {
+	b.cachedHash = hash
+}
+
+// SetOutputAmount changes the amount of the transaction's i'th output without
+// re-signing it.
+func (t *Transaction) SetOutputAmount(i int, amount uint64) {
+	t.outputs[i].Amount = amount
+}
+
+// SwapTransactions swaps the i'th and j'th transactions in the block without
+// mining it.
+func (b *Block) SwapTransactions(i, j int) {
+	b.transactions[i], b.transactions[j] = b.transactions[j], b.transactions[i]
+	b.cachedHash = nil
+}
+
+// SignRFC6979 exposes signRFC6979 to tests.
+var SignRFC6979 = signRFC6979
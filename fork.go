@@ -0,0 +1,230 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+)
+
+// ResolveLongest returns the longest of the given chains that is valid,
+// breaking ties in favor of the chain whose tip hash is lexicographically
+// smaller. The boolean result is false if none of the chains are valid.
+func ResolveLongest(chains ...Blockchain) (Blockchain, bool) {
+	var (
+		best        Blockchain
+		bestLen     int
+		bestTipHash string
+		found       bool
+	)
+	for _, c := range chains {
+		if !c.Valid() {
+			continue
+		}
+		length, tipHash := c.lenAndTipHash()
+		if !found || length > bestLen || (length == bestLen && tipHash < bestTipHash) {
+			best, bestLen, bestTipHash, found = c, length, tipHash, true
+		}
+	}
+	return best, found
+}
+
+// ResolveMostWork is like ResolveLongest, but chooses the valid chain with the
+// most total work as reported by TotalWork, so that a shorter chain mined at
+// a higher difficulty can beat a longer one. Ties are broken the same way.
+func ResolveMostWork(chains ...Blockchain) (Blockchain, bool) {
+	var (
+		best        Blockchain
+		bestWork    *big.Int
+		bestTipHash string
+		found       bool
+	)
+	for _, c := range chains {
+		if !c.Valid() {
+			continue
+		}
+		work, tipHash := c.workAndTipHash()
+		if !found || work.Cmp(bestWork) > 0 || (work.Cmp(bestWork) == 0 && tipHash < bestTipHash) {
+			best, bestWork, bestTipHash, found = c, work, tipHash, true
+		}
+	}
+	return best, found
+}
+
+// BlockRelation describes how a block relates to a chain. See Classify.
+type BlockRelation uint8
+
+const (
+	// RelationExtends blocks build on the chain's tip.
+	RelationExtends BlockRelation = iota
+	// RelationFork blocks build on an earlier block on the chain, or are a
+	// competing genesis block, starting a fork.
+	RelationFork
+	// RelationOrphan blocks build on a block the chain doesn't have, so they
+	// can't be placed until their ancestors are received.
+	RelationOrphan
+)
+
+// String returns the name of the relation.
+func (r BlockRelation) String() string {
+	switch r {
+	case RelationExtends:
+		return "extends"
+	case RelationFork:
+		return "fork"
+	case RelationOrphan:
+		return "orphan"
+	}
+	return "BlockRelation(" + strconv.Itoa(int(r)) + ")"
+}
+
+// Classify returns how b relates to the chain according to its previous hash,
+// which is useful for deciding what to do with a block received from a peer.
+// A block with an empty previous hash extends an empty chain, and forks any
+// other. The block itself isn't validated.
+func (c Blockchain) Classify(b *Block) BlockRelation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	back := c.l.Back()
+	if back == nil {
+		if len(b.prevHash) == 0 {
+			return RelationExtends
+		}
+		return RelationOrphan
+	}
+	if bytes.Equal(b.prevHash, back.Value.(*Block).Hash()) {
+		return RelationExtends
+	}
+	if len(b.prevHash) == 0 {
+		return RelationFork
+	}
+	for e := back.Prev(); e != nil; e = e.Prev() {
+		if bytes.Equal(b.prevHash, e.Value.(*Block).Hash()) {
+			return RelationFork
+		}
+	}
+	return RelationOrphan
+}
+
+// ReplaceWith replaces the chain's blocks with copies of other's, such as a
+// longer chain received from a peer. It returns an error, leaving the chain
+// untouched, unless other is valid under this chain's rules and is strictly
+// longer.
+func (c *Blockchain) ReplaceWith(other Blockchain) error {
+	// Copy and validate other before taking the lock, since it may share its
+	// lock with c.
+	candidate := *c
+	candidate.mu = new(sync.RWMutex)
+	candidate.l = other.Clone().l
+	for e := candidate.l.Front(); e != nil; e = e.Next() {
+		e.Value.(*Block).setHasher(c.newHash)
+	}
+	if err := candidate.validateFrom(0); err != nil {
+		return errors.New("blockchain.ReplaceWith: " + err.Error())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if candidate.l.Len() <= c.l.Len() {
+		return errors.New("blockchain.ReplaceWith: replacement is not longer than the current chain")
+	}
+	c.l.Init()
+	for e := candidate.l.Front(); e != nil; e = e.Next() {
+		c.push(e.Value.(*Block))
+	}
+	c.utxo.reset()
+	c.updateUTXO()
+	c.index.reset()
+	c.index.update(*c)
+	return nil
+}
+
+// RemoveTip removes the last block from the chain and returns it, such as to
+// replace it during a reorganization. It returns an error if the chain is
+// empty. The UTXO set and transaction index are updated to match.
+func (c *Blockchain) RemoveTip() (*Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	back := c.l.Back()
+	if back == nil {
+		return nil, errors.New("blockchain.RemoveTip: chain is empty")
+	}
+	block := back.Value.(*Block)
+	if c.utxo.applied == c.l.Len() {
+		c.utxo.unapply(block)
+	}
+	c.index.remove(block, c.l.Len())
+	c.l.Remove(back)
+	return block, nil
+}
+
+// lenAndTipHash returns the length of the chain and the hex-encoded hash of
+// its last block, or an empty string if it has none.
+func (c Blockchain) lenAndTipHash() (int, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	back := c.l.Back()
+	if back == nil {
+		return 0, ""
+	}
+	return c.l.Len(), back.Value.(*Block).HashString()
+}
+
+// workAndTipHash is like lenAndTipHash, but returns the chain's total work
+// instead of its length.
+func (c Blockchain) workAndTipHash() (*big.Int, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	back := c.l.Back()
+	if back == nil {
+		return new(big.Int), ""
+	}
+	return c.totalWork(), back.Value.(*Block).HashString()
+}
+
+// Relink repairs a chain whose blocks were modified in place, such as by a
+// test, by pointing each block's previous hash at the current hash of the
+// block before it and proving again, at the difficulty required at its
+// height if that's higher than its own, any block that was changed or is no
+// longer proven. Timestamps and transactions aren't touched, so the chain may
+// still be invalid for other reasons, and pruned blocks can't be changed. It's
+// meant for testing and recovery, since relinking a chain changes the hash of
+// every block after the first one that was modified. It stops with an error at
+// the first block that can't be proven, leaving the blocks after it as they
+// were.
+func (c *Blockchain) Relink() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	difficulty := c.difficulty
+	var prevHash []byte
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		block := e.Value.(*Block)
+		if !block.Pruned() {
+			changed := !bytes.Equal(block.prevHash, prevHash)
+			if changed {
+				block.prevHash = cloneBytes(prevHash)
+				block.cachedHash = nil
+			}
+			if block.difficulty < difficulty {
+				block.difficulty = difficulty
+				block.cachedHash = nil
+				changed = true
+			}
+			if changed || !c.consensus.ValidateBlock(block) {
+				if err := c.consensus.ProveBlock(block); err != nil {
+					return errors.New("blockchain.Relink: block " + strconv.Itoa(block.height) + ": " + err.Error())
+				}
+			}
+		}
+		prevHash = block.Hash()
+		difficulty = c.retarget(e, difficulty)
+	}
+	return nil
+}
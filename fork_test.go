@@ -0,0 +1,273 @@
+package blockchain_test
+
+import (
+	"math/big"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestResolveLongest(t *testing.T) {
+	short, long := chainOfLength(2), chainOfLength(3)
+
+	winner, ok := blockchain.ResolveLongest(short, long)
+	if !ok {
+		t.Fatal("no chain was chosen")
+	}
+	if winner.Len() != 3 {
+		t.Errorf("winner length = %d, want 3", winner.Len())
+	}
+}
+
+func TestResolveMostWork(t *testing.T) {
+	// Three blocks at difficulty 8 are 768 units of work, while five at
+	// difficulty 1 are only 10.
+	heavy := blockchain.New(8)
+	for i := 0; i < 3; i++ {
+		heavy.Add([]byte("heavy"))
+	}
+	light := blockchain.New(1)
+	for i := 0; i < 5; i++ {
+		light.Add([]byte("light"))
+	}
+
+	if got, want := heavy.TotalWork(), big.NewInt(3*256); got.Cmp(want) != 0 {
+		t.Errorf("heavy chain total work = %s, want %s", got, want)
+	}
+	if got, want := light.TotalWork(), big.NewInt(5*2); got.Cmp(want) != 0 {
+		t.Errorf("light chain total work = %s, want %s", got, want)
+	}
+
+	if winner, _ := blockchain.ResolveLongest(heavy, light); winner.Len() != 5 {
+		t.Errorf("ResolveLongest chose a chain of length %d, want 5", winner.Len())
+	}
+	for _, chains := range [][]blockchain.Blockchain{{heavy, light}, {light, heavy}} {
+		winner, ok := blockchain.ResolveMostWork(chains...)
+		if !ok {
+			t.Fatal("no chain was chosen")
+		}
+		if winner.Len() != 3 {
+			t.Errorf("ResolveMostWork chose a chain of length %d, want 3", winner.Len())
+		}
+	}
+	if _, ok := blockchain.ResolveMostWork(); ok {
+		t.Error("a chain was chosen from none")
+	}
+}
+
+func TestRemoveTip(t *testing.T) {
+	chain := chainOfLength(3)
+	second, _ := chain.GetBlock(1)
+	third, _ := chain.GetBlock(2)
+
+	removed, err := chain.RemoveTip()
+	if err != nil {
+		t.Fatalf("failed to remove tip: %s", err)
+	}
+	if removed != third {
+		t.Error("RemoveTip did not return the former tip")
+	}
+	if chain.Len() != 2 {
+		t.Errorf("chain length = %d, want 2", chain.Len())
+	}
+	if tip, ok := chain.Tip(); !ok || tip != second {
+		t.Error("tip is not the former second block")
+	}
+	if !chain.Valid() {
+		t.Error("chain is not valid after removing its tip")
+	}
+
+	empty := blockchain.New(0)
+	if _, err := empty.RemoveTip(); err == nil {
+		t.Error("expected an error removing the tip of an empty chain")
+	}
+}
+
+func TestRemoveTipTransactions(t *testing.T) {
+	chain := blockchain.New(0)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	var hashes [][]byte
+	for i := 0; i < 2; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 10, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		var pool blockchain.Mempool
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+		chain.MineBlock(&pool, 1)
+		hashes = append(hashes, tx.Hash())
+	}
+	if got := chain.UTXO().Balance(you.PublicKey()); got != 20 {
+		t.Fatalf("UTXO balance = %d, want 20", got)
+	}
+
+	if _, err := chain.RemoveTip(); err != nil {
+		t.Fatalf("failed to remove tip: %s", err)
+	}
+	if _, _, ok := chain.FindTransaction(hashes[1]); ok {
+		t.Error("found a transaction from the removed block")
+	}
+	if _, _, ok := chain.FindTransaction(hashes[0]); !ok {
+		t.Error("transaction from a remaining block not found")
+	}
+	if got := chain.UTXO().Balance(you.PublicKey()); got != 10 {
+		t.Errorf("UTXO balance = %d, want 10", got)
+	}
+	if got := chain.UTXO().Balance(me.PublicKey()); got != -10 {
+		t.Errorf("sender UTXO balance = %d, want -10", got)
+	}
+}
+
+func TestResolveLongestTie(t *testing.T) {
+	a, b := chainOfLength(2), chainOfLength(2)
+	smaller := a
+	if tipHash(b) < tipHash(a) {
+		smaller = b
+	}
+
+	for _, chains := range [][]blockchain.Blockchain{{a, b}, {b, a}} {
+		winner, ok := blockchain.ResolveLongest(chains...)
+		if !ok {
+			t.Fatal("no chain was chosen")
+		}
+		if tipHash(winner) != tipHash(smaller) {
+			t.Errorf("winner tip = %s, want %s", tipHash(winner), tipHash(smaller))
+		}
+	}
+}
+
+func TestResolveLongestInvalid(t *testing.T) {
+	const difficulty = 1
+
+	short := chainOfLength(2)
+	invalid := chainOfLength(3)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := invalid.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("forged")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.TamperSignature(0)
+	block.Mine(difficulty)
+
+	winner, ok := blockchain.ResolveLongest(invalid, short)
+	if !ok {
+		t.Fatal("no chain was chosen")
+	}
+	if winner.Len() != 2 {
+		t.Errorf("winner length = %d, want 2", winner.Len())
+	}
+
+	if _, ok := blockchain.ResolveLongest(invalid); ok {
+		t.Error("chose an invalid chain")
+	}
+}
+
+func TestReplaceWith(t *testing.T) {
+	const difficulty = 1
+
+	chain := chainOfLength(2)
+	original := blockHashes(chain)
+
+	if err := chain.ReplaceWith(chainOfLength(2)); err == nil {
+		t.Error("expected an error replacing with a chain of the same length")
+	}
+	if err := chain.ReplaceWith(chainOfLength(1)); err == nil {
+		t.Error("expected an error replacing with a shorter chain")
+	}
+
+	invalid := chainOfLength(3)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := invalid.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("forged")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.TamperSignature(0)
+	block.Mine(difficulty)
+	if err := chain.ReplaceWith(invalid); err == nil {
+		t.Error("expected an error replacing with an invalid chain")
+	}
+	if got := blockHashes(chain); !equalStrings(got, original) {
+		t.Errorf("chain changed after failed replacements: %v, want %v", got, original)
+	}
+
+	longer := chainOfLength(4)
+	if err := chain.ReplaceWith(longer); err != nil {
+		t.Fatalf("failed to replace chain: %s", err)
+	}
+	if got, want := blockHashes(chain), blockHashes(longer); !equalStrings(got, want) {
+		t.Errorf("replaced chain hashes = %v, want %v", got, want)
+	}
+	if !chain.Valid() {
+		t.Error("replaced chain is not valid")
+	}
+}
+
+func chainOfLength(n int) blockchain.Blockchain {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	for i := 0; i < n; i++ {
+		chain.Add([]byte("block"))
+	}
+	return chain
+}
+
+func tipHash(chain blockchain.Blockchain) string {
+	block, ok := chain.Tip()
+	if !ok {
+		return ""
+	}
+	return block.HashString()
+}
+
+func TestClassify(t *testing.T) {
+	chain := blockchain.New(0)
+	if got := chain.Classify(blockchain.NewBlock(nil, []byte("genesis"))); got != blockchain.RelationExtends {
+		t.Errorf("genesis block on an empty chain: Classify = %s, want %s", got, blockchain.RelationExtends)
+	}
+	genesis := chain.Add([]byte("genesis"))
+	chain.Add([]byte("one"))
+	tip := chain.Add([]byte("two"))
+
+	other := blockchain.New(0)
+	other.Add([]byte("elsewhere"))
+	unknown, _ := other.Tip()
+
+	for _, c := range []struct {
+		name  string
+		block *blockchain.Block
+		want  blockchain.BlockRelation
+	}{
+		{"tip", blockchain.NewBlock(tip.Hash(), nil), blockchain.RelationExtends},
+		{"earlier block", blockchain.NewBlock(genesis.Hash(), nil), blockchain.RelationFork},
+		{"competing genesis", blockchain.NewBlock(nil, nil), blockchain.RelationFork},
+		{"unknown block", blockchain.NewBlock(unknown.Hash(), nil), blockchain.RelationOrphan},
+	} {
+		if got := chain.Classify(c.block); got != c.want {
+			t.Errorf("%s: Classify = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRelink(t *testing.T) {
+	const difficulty = 4
+
+	chain := blockchain.New(difficulty)
+	for _, data := range []string{"genesis", "one", "two", "three"} {
+		chain.Add([]byte(data))
+	}
+	middle, _ := chain.GetBlock(2)
+	middle.SetPrevHash([]byte("stale"))
+	if chain.Valid() {
+		t.Fatal("chain is valid with a corrupted previous hash")
+	}
+
+	if err := chain.Relink(); err != nil {
+		t.Fatalf("failed to relink chain: %s", err)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Errorf("chain is not valid after relinking: %s", err)
+	}
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"hash"
+	"maps"
+	"slices"
+	"time"
+)
+
+// BlockHeader holds everything a block's hash commits to, with the block's
+// data, metadata, allocations, and transactions standing in as hashes, so
+// that light clients can follow a chain without downloading block bodies.
+type BlockHeader struct {
+	PrevHash   []byte
+	Timestamp  time.Time
+	Nonce      uint32
+	Difficulty int
+	// DataHash, MetaHash, and AllocHash are hashes of the block's data,
+	// metadata, and the balances it allocates if it's a genesis block.
+	DataHash, MetaHash, AllocHash []byte
+	// Miner is the miner's public key in PKIX, ASN.1 DER form, or empty if
+	// the block has no miner.
+	Miner []byte
+	// MerkleRoot is the Merkle root of the block's transactions.
+	MerkleRoot []byte
+
+	// newHash is the hash function of the block the header came from, or nil
+	// for SHA-256.
+	newHash func() hash.Hash
+
+	// prunedHash is the hash of the block the header came from, if it was
+	// pruned and the rest of the header is lost.
+	prunedHash []byte
+}
+
+// Header returns the block's header. A pruned block no longer has most of
+// the fields, so its header only holds the ones it kept, but still has the
+// block's hash.
+func (b Block) Header() BlockHeader {
+	h := BlockHeader{
+		PrevHash:   cloneBytes(b.prevHash),
+		Timestamp:  b.timestamp,
+		Nonce:      b.nonce,
+		Difficulty: b.difficulty,
+		newHash:    b.newHash,
+		prunedHash: cloneBytes(b.prunedHash),
+	}
+	if b.prunedHash != nil {
+		return h
+	}
+
+	hasher := newHasher(b.newHash)
+	hasher.Write(b.data)
+	h.DataHash = hasher.Sum(nil)
+
+	hasher = newHasher(b.newHash)
+	for _, key := range slices.Sorted(maps.Keys(b.meta)) {
+		hasher.Write(appendBytes(appendBytes(nil, []byte(key)), []byte(b.meta[key])))
+	}
+	h.MetaHash = hasher.Sum(nil)
+	h.AllocHash = b.allocHash()
+
+	if b.miner != nil {
+		h.Miner = mustBinary(x509.MarshalPKIXPublicKey(b.miner))
+	}
+	h.MerkleRoot = b.MerkleRoot()
+	return h
+}
+
+// Hash returns the hash of the block the header came from. See Block.Hash.
+func (h BlockHeader) Hash() []byte {
+	if h.prunedHash != nil {
+		return cloneBytes(h.prunedHash)
+	}
+
+	hasher := newHasher(h.newHash)
+	hasher.Write(h.preimage())
+	return hasher.Sum(nil)
+}
+
+// preimage returns the bytes hashed by Hash.
+func (h BlockHeader) preimage() []byte {
+	var buf []byte
+	buf = append(buf, h.PrevHash...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Timestamp.UnixNano()))
+	buf = binary.LittleEndian.AppendUint32(buf, h.Nonce)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(h.Difficulty))
+	buf = append(buf, h.DataHash...)
+	buf = append(buf, h.MetaHash...)
+	buf = append(buf, h.AllocHash...)
+	buf = append(buf, h.Miner...)
+	buf = append(buf, h.MerkleRoot...)
+	return buf
+}
+
+// HashPreimage returns the exact bytes fed to the block's hash function by
+// Hash, so that its hash can be reproduced elsewhere: the previous hash, the
+// timestamp in Unix nanoseconds as a big-endian uint64, the nonce and
+// difficulty as little-endian uint32s, the hashes of the data, metadata, and
+// allocations, the miner's public key in PKIX, ASN.1 DER form, and the Merkle
+// root of the transactions. A pruned block's preimage is lost, so it returns
+// nil.
+func (b Block) HashPreimage() []byte {
+	if b.prunedHash != nil {
+		return nil
+	}
+	return b.Header().preimage()
+}
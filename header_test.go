@@ -0,0 +1,83 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/gob"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestBlockHeader(t *testing.T) {
+	const difficulty = 2
+
+	chain := blockchain.New(difficulty)
+	chain.Add([]byte("genesis"))
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tip, _ := chain.Tip()
+	block := blockchain.NewBlockForMiner(tip.Hash(), me.PublicKey(), []byte("body"))
+	block.SetMeta("version", "1")
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("hello")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.Mine(difficulty)
+	if err := chain.AppendBlock(block); err != nil {
+		t.Fatalf("failed to append block: %s", err)
+	}
+
+	header := block.Header()
+	if !bytes.Equal(header.Hash(), block.Hash()) {
+		t.Error("header hash does not equal the block hash")
+	}
+	if !bytes.Equal(header.MerkleRoot, block.MerkleRoot()) {
+		t.Error("header does not hold the block's Merkle root")
+	}
+
+	// Headers can be sent to light clients on their own.
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(header); err != nil {
+		t.Fatalf("failed to encode header: %s", err)
+	}
+	var decoded blockchain.BlockHeader
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("failed to decode header: %s", err)
+	}
+	if !bytes.Equal(decoded.Hash(), block.Hash()) {
+		t.Error("decoded header hash does not equal the block hash")
+	}
+
+	decoded.DataHash[0] ^= 0xff
+	if bytes.Equal(decoded.Hash(), block.Hash()) {
+		t.Error("tampered header still has the block's hash")
+	}
+
+	if err := chain.Prune(0); err != nil {
+		t.Fatalf("failed to prune chain: %s", err)
+	}
+	for pruned := range chain.Blocks() {
+		if !bytes.Equal(pruned.Header().Hash(), pruned.Hash()) {
+			t.Errorf("pruned block %d: header hash does not equal the block hash", pruned.Height())
+		}
+	}
+}
+
+func TestHashPreimage(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	genesis := blockchain.NewChainWithAlloc(1, map[*ecdsa.PublicKey]uint64{me.PublicKey(): 10})
+	first, _ := genesis.Tip()
+
+	block := blockchain.NewBlockForMiner(first.Hash(), me.PublicKey(), []byte("body"))
+	block.SetMeta("version", "1")
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("hello")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	block.Mine(1)
+
+	for _, b := range []*blockchain.Block{first, block} {
+		if sum := sha256.Sum256(b.HashPreimage()); !bytes.Equal(sum[:], b.Hash()) {
+			t.Errorf("block %d: hash of preimage %x does not equal the block hash %x", b.Height(), sum, b.Hash())
+		}
+	}
+}
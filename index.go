@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+)
+
+// txIndex maps the hex-encoded hash of each transaction on a chain to the
+// block it's in, so that transactions can be found without scanning every
+// block. Its methods are safe for concurrent use.
+type txIndex struct {
+	mu     sync.Mutex
+	blocks map[string]*Block
+	// indexed is the number of blocks from the front of the chain whose
+	// transactions are in blocks.
+	indexed int
+}
+
+func newTxIndex() *txIndex {
+	return &txIndex{blocks: make(map[string]*Block)}
+}
+
+// update indexes any of the chain's blocks that aren't indexed yet. The caller
+// must hold the chain's lock, at least for reading.
+func (x *txIndex) update(c Blockchain) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	e := c.l.Back()
+	for i := c.l.Len() - 1; i > x.indexed; i-- {
+		e = e.Prev()
+	}
+	for ; e != nil && x.indexed < c.l.Len(); e = e.Next() {
+		block := e.Value.(*Block)
+		for _, t := range block.transactions {
+			x.blocks[hex.EncodeToString(t.Hash())] = block
+		}
+		x.indexed++
+	}
+}
+
+// remove drops the last of the chain's blocks from the index, if it's been
+// indexed. The chain has n blocks, including this one.
+func (x *txIndex) remove(block *Block, n int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.indexed < n {
+		return
+	}
+	for _, t := range block.transactions {
+		key := hex.EncodeToString(t.Hash())
+		if x.blocks[key] == block {
+			delete(x.blocks, key)
+		}
+	}
+	x.indexed--
+}
+
+// reset empties the index, so that it no longer covers any blocks.
+func (x *txIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.blocks = make(map[string]*Block)
+	x.indexed = 0
+}
+
+// lookup returns the indexed block holding the transaction with the given
+// hash.
+func (x *txIndex) lookup(hash []byte) (*Block, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	block, ok := x.blocks[hex.EncodeToString(hash)]
+	return block, ok
+}
+
+// FindTransaction returns the transaction with the given hash along with the
+// block it's in, or false if it isn't on the chain. It's answered from an
+// index rather than by scanning the chain. Like the UTXO set, the index is
+// kept up to date by Add, AppendBlock, and MineBlock; blocks created with
+// NewBlock are indexed once FindTransaction or one of those is next called,
+// and should be finished before then.
+func (c Blockchain) FindTransaction(hash []byte) (Transaction, *Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.index.update(c)
+	block, ok := c.index.lookup(hash)
+	if !ok {
+		return Transaction{}, nil, false
+	}
+	for _, t := range block.transactions {
+		if bytes.Equal(t.Hash(), hash) {
+			return t, block, true
+		}
+	}
+	return Transaction{}, nil, false
+}
+
+// Confirmations returns the number of blocks from the one holding the
+// transaction with the given hash up to the tip, including both, so that a
+// transaction in the tip has one confirmation. It returns false if the
+// transaction isn't on the chain. Like FindTransaction, it's answered from the
+// chain's index.
+func (c Blockchain) Confirmations(txHash []byte) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.index.update(c)
+	block, ok := c.index.lookup(txHash)
+	if !ok {
+		return 0, false
+	}
+	return c.l.Len() - block.height, true
+}
@@ -0,0 +1,121 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestFindTransaction(t *testing.T) {
+	chain, hashes := chainWithTransactions(t, 4, 3)
+
+	for i, hash := range hashes {
+		tx, block, ok := chain.FindTransaction(hash)
+		if !ok {
+			t.Fatalf("transaction %d not found", i)
+		}
+		if !bytes.Equal(tx.Hash(), hash) {
+			t.Errorf("transaction %d: found a transaction with a different hash", i)
+		}
+		if want := i / 3; block.Height() != want {
+			t.Errorf("transaction %d: found in block %d, want %d", i, block.Height(), want)
+		}
+	}
+	if _, _, ok := chain.FindTransaction([]byte("missing")); ok {
+		t.Error("found a transaction that isn't on the chain")
+	}
+
+	// Blocks created with NewBlock are indexed once they're finished.
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("late")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	if _, found, ok := chain.FindTransaction(block.Transactions()[0].Hash()); !ok || found != block {
+		t.Error("transaction sent with a block from NewBlock not found")
+	}
+
+	// Pruned transactions are dropped from the index.
+	if err := chain.Prune(1); err != nil {
+		t.Fatalf("failed to prune chain: %s", err)
+	}
+	if _, _, ok := chain.FindTransaction(hashes[0]); ok {
+		t.Error("found a pruned transaction")
+	}
+}
+
+func TestFindTransactionReplaceWith(t *testing.T) {
+	chain, hashes := chainWithTransactions(t, 1, 1)
+	longer, longerHashes := chainWithTransactions(t, 2, 1)
+	if err := chain.ReplaceWith(longer); err != nil {
+		t.Fatalf("failed to replace chain: %s", err)
+	}
+
+	if _, _, ok := chain.FindTransaction(hashes[0]); ok {
+		t.Error("found a transaction from the replaced chain")
+	}
+	for i, hash := range longerHashes {
+		_, block, ok := chain.FindTransaction(hash)
+		if !ok {
+			t.Fatalf("transaction %d from the replacement not found", i)
+		}
+		if got, _ := chain.GetBlock(i); block != got {
+			t.Errorf("transaction %d was found in a block that isn't on the chain", i)
+		}
+	}
+}
+
+func BenchmarkFindTransaction(b *testing.B) {
+	chain, hashes := chainWithTransactions(b, 100, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.FindTransaction(hashes[i%len(hashes)])
+	}
+}
+
+func BenchmarkFindTransactionLinear(b *testing.B) {
+	chain, hashes := chainWithTransactions(b, 100, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.HasTransaction(hashes[i%len(hashes)])
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	chain, hashes := chainWithTransactions(t, 4, 1)
+	for i, hash := range hashes {
+		if got, ok := chain.Confirmations(hash); !ok || got != 4-i {
+			t.Errorf("transaction in block %d: Confirmations = %d, %t, want %d, true", i, got, ok, 4-i)
+		}
+	}
+	if _, ok := chain.Confirmations([]byte("missing")); ok {
+		t.Error("found confirmations for a missing transaction")
+	}
+}
+
+// chainWithTransactions returns a chain of the given number of blocks, each
+// holding perBlock transactions, along with the hashes of the transactions in
+// order.
+func chainWithTransactions(tb testing.TB, blocks, perBlock int) (blockchain.Blockchain, [][]byte) {
+	tb.Helper()
+
+	chain := blockchain.New(0)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	var hashes [][]byte
+	for i := 0; i < blocks; i++ {
+		var pool blockchain.Mempool
+		for j := 0; j < perBlock; j++ {
+			tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+			if err != nil {
+				tb.Fatalf("failed to create transaction: %s", err)
+			}
+			if err := pool.Add(tx); err != nil {
+				tb.Fatalf("failed to add transaction to pool: %s", err)
+			}
+			hashes = append(hashes, tx.Hash())
+		}
+		chain.MineBlock(&pool, perBlock)
+	}
+	return chain, hashes
+}
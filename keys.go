@@ -0,0 +1,40 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+)
+
+// SenderCompressed returns the sender's public key in hex-encoded, compressed
+// SEC 1 form, which is much shorter than the PKIX form returned by Sender.
+func (t Transaction) SenderCompressed() string {
+	return compressPublicKey(t.sender)
+}
+
+// ReceiverCompressed is like SenderCompressed for the receiver's public key.
+func (t Transaction) ReceiverCompressed() string {
+	return compressPublicKey(t.receiver)
+}
+
+// compressPublicKey returns pub in hex-encoded, compressed SEC 1 form.
+func compressPublicKey(pub *ecdsa.PublicKey) string {
+	return hex.EncodeToString(elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y))
+}
+
+// ParseCompressedPublicKey parses a public key on the given curve from the
+// hex-encoded, compressed SEC 1 form returned by SenderCompressed and
+// ReceiverCompressed. The compressed form doesn't identify its curve, so it
+// must be known in advance.
+func ParseCompressedPublicKey(curve elliptic.Curve, s string) (*ecdsa.PublicKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("blockchain.ParseCompressedPublicKey: " + err.Error())
+	}
+	x, y := elliptic.UnmarshalCompressed(curve, data)
+	if x == nil {
+		return nil, errors.New("blockchain.ParseCompressedPublicKey: invalid compressed public key")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -0,0 +1,42 @@
+package blockchain_test
+
+import (
+	"crypto/elliptic"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestCompressedPublicKeys(t *testing.T) {
+	me := mustIdentity(blockchain.NewIdentityWithCurve(elliptic.P256()))
+	you := mustIdentity(blockchain.NewIdentityWithCurve(elliptic.P256()))
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	for _, c := range []struct {
+		name       string
+		compressed string
+		identity   blockchain.Identity
+	}{
+		{"sender", tx.SenderCompressed(), me},
+		{"receiver", tx.ReceiverCompressed(), you},
+	} {
+		// A compressed P-256 key is a one-byte prefix and a 32-byte coordinate.
+		if got, want := len(c.compressed), 2*33; got != want {
+			t.Errorf("%s: compressed key has %d hex digits, want %d", c.name, got, want)
+		}
+		pub, err := blockchain.ParseCompressedPublicKey(elliptic.P256(), c.compressed)
+		if err != nil {
+			t.Fatalf("%s: failed to parse compressed key: %s", c.name, err)
+		}
+		if !pub.Equal(c.identity.PublicKey()) {
+			t.Errorf("%s: parsed key does not equal the original", c.name)
+		}
+	}
+
+	if _, err := blockchain.ParseCompressedPublicKey(elliptic.P256(), "02ffff"); err == nil {
+		t.Error("expected an error parsing a truncated key")
+	}
+}
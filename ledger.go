@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ledgerHeader is the header row written by ExportLedger.
+var ledgerHeader = []string{"block-height", "tx-hash", "sender", "receiver", "data-length", "amount"}
+
+// ExportLedger writes the chain's transactions to w as CSV, one row per
+// transaction in chain order after a header row, for inspection in a
+// spreadsheet. The columns are the height of the block holding the
+// transaction, its hex-encoded hash, the hex-encoded public keys of the sender
+// and receiver as returned by Sender and Receiver, the length of its data, and
+// the amount it transfers, which is left empty for message transactions.
+func (c Blockchain) ExportLedger(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ledgerHeader); err != nil {
+		return errors.New("blockchain.ExportLedger: " + err.Error())
+	}
+	for _, block := range c.blocks() {
+		for _, t := range block.transactions {
+			sender, err := t.SenderErr()
+			if err != nil {
+				return errors.New("blockchain.ExportLedger: " + err.Error())
+			}
+			receiver, err := t.ReceiverErr()
+			if err != nil {
+				return errors.New("blockchain.ExportLedger: " + err.Error())
+			}
+			var amount string
+			if t.kind != TxMessage {
+				amount = strconv.FormatUint(t.amount, 10)
+			}
+			row := []string{
+				strconv.Itoa(block.height),
+				hex.EncodeToString(t.Hash()),
+				sender,
+				receiver,
+				strconv.Itoa(len(t.data)),
+				amount,
+			}
+			if err := cw.Write(row); err != nil {
+				return errors.New("blockchain.ExportLedger: " + err.Error())
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errors.New("blockchain.ExportLedger: " + err.Error())
+	}
+	return nil
+}
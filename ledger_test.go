@@ -0,0 +1,41 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestExportLedger(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 7, []byte("rent"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	var pool blockchain.Mempool
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	chain := blockchain.New(0)
+	chain.MineBlock(&pool, 1)
+
+	var buf bytes.Buffer
+	if err := chain.ExportLedger(&buf); err != nil {
+		t.Fatalf("failed to export ledger: %s", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read ledger: %s", err)
+	}
+	want := [][]string{
+		{"block-height", "tx-hash", "sender", "receiver", "data-length", "amount"},
+		{"0", hex.EncodeToString(tx.Hash()), tx.Sender(), tx.Receiver(), "4", "7"},
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("ledger = %q, want %q", rows, want)
+	}
+}
@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Mempool holds signed transactions that are waiting to be mined into a
+// block. The zero value is an empty pool ready to use, and its methods are
+// safe for concurrent use.
+type Mempool struct {
+	mu      sync.Mutex
+	pending []Transaction
+	// chain, if set, is the chain the pool's transactions are mined into.
+	chain *Blockchain
+}
+
+// NewMempool returns an empty pool for transactions to be mined into chain.
+// Unlike the zero value, it also refuses transactions that are already on the
+// chain.
+func NewMempool(chain *Blockchain) *Mempool {
+	return &Mempool{chain: chain}
+}
+
+// Add adds a transaction to the pool, returning an error if its signature
+// can't be verified, if the pool already holds it, or if the pool was made by
+// NewMempool and the transaction is already on the chain.
+func (p *Mempool) Add(t Transaction) error {
+	if !t.Verify() {
+		return errors.New("blockchain.Mempool.Add: transaction is not signed by its sender")
+	}
+	hash := t.Hash()
+	if p.chain != nil && p.chain.HasTransaction(hash) {
+		return errors.New("blockchain.Mempool.Add: transaction is already on the chain")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pending := range p.pending {
+		if bytes.Equal(pending.Hash(), hash) {
+			return errors.New("blockchain.Mempool.Add: transaction is already in the pool")
+		}
+	}
+	p.pending = append(p.pending, t)
+	return nil
+}
+
+// AddOrReplace is like Add, but if the pool already holds a version of the
+// transaction, it keeps whichever pays the higher fee, so that a sender can
+// speed up a pending transaction by resubmitting it. Two transactions are
+// versions of each other if they're of the same kind from the same sender to
+// the same receiver, with the same amount and data, regardless of their fees
+// and when they were signed. A replacement takes its predecessor's place in
+// the pool, and AddOrReplace reports whether one was made. It returns an error
+// if the transaction doesn't pay a higher fee than the version already in the
+// pool, or, like Add, if the transaction is already on the pool's chain.
+func (p *Mempool) AddOrReplace(t Transaction) (replaced bool, err error) {
+	if !t.Verify() {
+		return false, errors.New("blockchain.Mempool.AddOrReplace: transaction is not signed by its sender")
+	}
+	if p.chain != nil && p.chain.HasTransaction(t.Hash()) {
+		return false, errors.New("blockchain.Mempool.AddOrReplace: transaction is already on the chain")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, pending := range p.pending {
+		if !sameIntent(pending, t) {
+			continue
+		}
+		if t.fee <= pending.fee {
+			return false, errors.New("blockchain.Mempool.AddOrReplace: transaction does not pay a higher fee than the one it would replace")
+		}
+		p.pending[i] = t
+		return true, nil
+	}
+	p.pending = append(p.pending, t)
+	return false, nil
+}
+
+// sameIntent returns true if a and b are versions of the same transaction,
+// differing at most in their fees, timestamps, random bytes, and signatures.
+func sameIntent(a, b Transaction) bool {
+	return a.kind == b.kind &&
+		keysEqual(a.sender, b.sender) &&
+		keysEqual(a.receiver, b.receiver) &&
+		a.amount == b.amount &&
+		slices.EqualFunc(a.outputs, b.outputs, outputsEqual) &&
+		bytes.Equal(a.data, b.data)
+}
+
+// Pending returns the transactions currently in the pool, oldest first.
+func (p *Mempool) Pending() []Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Transaction(nil), p.pending...)
+}
+
+// Drain removes and returns up to max of the oldest transactions in the pool.
+func (p *Mempool) Drain(max int) []Transaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if max > len(p.pending) {
+		max = len(p.pending)
+	}
+	if max < 0 {
+		max = 0
+	}
+	drained := append([]Transaction(nil), p.pending[:max]...)
+	p.pending = append(p.pending[:0], p.pending[max:]...)
+	return drained
+}
+
+// requeue puts transactions back at the front of the pool, ahead of any
+// added since they were drained, keeping their order.
+func (p *Mempool) requeue(ts []Transaction) {
+	if len(ts) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = append(ts, p.pending...)
+}
+
+// MineBlock drains up to max transactions from pool into a new block on top
+// of the chain, proves it like Add, and appends it, returning a reference to
+// it. No more transactions are drained than the chain allows in a block. Any
+// that the block has no room for, by size or by number of transactions, are
+// put back in the pool to wait for a later block. Any that it rejects for
+// good, such as for not being allowed by the chain or lacking data the chain
+// requires, are dropped, as are copies of ones already in the block and ones
+// already on the chain, which mustn't be mined again. If the block can't be
+// proven, nothing is appended, every drained transaction that isn't on the
+// chain is put back, and MineBlock returns nil.
+func (c *Blockchain) MineBlock(pool *Mempool, max int) *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxTxPerBlock > 0 && max > c.maxTxPerBlock {
+		max = c.maxTxPerBlock
+	}
+	block := c.next(nil)
+	c.index.update(*c)
+	var drained, requeued []Transaction
+	for _, t := range pool.Drain(max) {
+		if _, ok := c.index.lookup(t.Hash()); ok {
+			continue
+		}
+		drained = append(drained, t)
+		if block.ContainsTransaction(t.Hash()) {
+			continue
+		}
+		if err := block.AddTransaction(t); err == errBlockFull || err == errBlockTooLarge {
+			requeued = append(requeued, t)
+		}
+	}
+	if err := c.consensus.ProveBlock(block); err != nil {
+		pool.requeue(drained)
+		return nil
+	}
+	pool.requeue(requeued)
+	c.push(block)
+	c.index.update(*c)
+	return block
+}
@@ -0,0 +1,267 @@
+package blockchain_test
+
+import (
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestMempoolRejectsUnsigned(t *testing.T) {
+	var pool blockchain.Mempool
+	if err := pool.Add(blockchain.Transaction{}); err == nil {
+		t.Error("expected an error adding an unsigned transaction")
+	}
+	if len(pool.Pending()) != 0 {
+		t.Error("unsigned transaction was added to the pool")
+	}
+}
+
+func TestMineBlock(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	var pool blockchain.Mempool
+	for i := 0; i < 2; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+	}
+
+	block := chain.MineBlock(&pool, 5)
+	if got := len(block.Transactions()); got != 2 {
+		t.Errorf("mined block has %d transactions, want 2", got)
+	}
+	if got := len(pool.Pending()); got != 0 {
+		t.Errorf("pool still has %d pending transactions", got)
+	}
+	if !chain.Valid() {
+		t.Error("blockchain is not valid")
+	}
+}
+
+func TestMineBlockRespectsLimit(t *testing.T) {
+	const (
+		difficulty = 1
+		limit      = 2
+	)
+
+	chain := blockchain.NewWithLimit(difficulty, limit)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	var pool blockchain.Mempool
+	for i := 0; i < 3; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+	}
+
+	block := chain.MineBlock(&pool, 10)
+	if got := len(block.Transactions()); got != limit {
+		t.Errorf("mined block has %d transactions, want %d", got, limit)
+	}
+	if got := len(pool.Pending()); got != 1 {
+		t.Errorf("pool has %d pending transactions, want 1", got)
+	}
+}
+
+func TestMineBlockRequeuesRejected(t *testing.T) {
+	const (
+		maxSize = 400
+		pending = 5
+	)
+
+	chain := blockchain.NewChain(blockchain.WithDifficulty(1), blockchain.WithMaxBlockSize(maxSize))
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	var pool blockchain.Mempool
+	for i := 0; i < pending; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), uint64(i), []byte("too big to share a block"))
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+	}
+
+	block := chain.MineBlock(&pool, pending)
+	mined, left := len(block.Transactions()), len(pool.Pending())
+	if mined == 0 || left == 0 {
+		t.Fatalf("mined %d transactions and left %d, want some of each", mined, left)
+	}
+	if mined+left != pending {
+		t.Errorf("mined %d transactions and left %d, want %d in all", mined, left, pending)
+	}
+	for _, tx := range pool.Pending() {
+		if block.ContainsTransaction(tx.Hash()) {
+			t.Error("mined transaction was put back in the pool")
+		}
+	}
+}
+
+func TestMineBlockDropsDisallowed(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	stranger := mustIdentity(blockchain.NewIdentity())
+	chain := blockchain.NewChain(
+		blockchain.WithDifficulty(1),
+		blockchain.WithMaxTxPerBlock(2),
+		blockchain.WithAllowedSenders(me.PublicKey()),
+	)
+
+	var pool blockchain.Mempool
+	for _, from := range []blockchain.Identity{stranger, me, me} {
+		tx, err := blockchain.NewValueTransaction(from, you.PublicKey(), 1, nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+	}
+
+	// The stranger's transaction will never be allowed, so it mustn't be put
+	// back at the front of the pool, where it would be drained into every
+	// block.
+	for i := 0; i < 2; i++ {
+		block := chain.MineBlock(&pool, 2)
+		if got := len(block.Transactions()); got != 1 {
+			t.Errorf("block %d has %d transactions, want 1", i, got)
+		}
+	}
+	if got := len(pool.Pending()); got != 0 {
+		t.Errorf("pool still has %d pending transactions", got)
+	}
+}
+
+func TestMempoolDrain(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	var pool blockchain.Mempool
+	for i := 0; i < 3; i++ {
+		tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), uint64(i), nil)
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction to pool: %s", err)
+		}
+	}
+
+	drained := pool.Drain(2)
+	if len(drained) != 2 || drained[0].Amount() != 0 || drained[1].Amount() != 1 {
+		t.Errorf("drained unexpected transactions: %v", drained)
+	}
+	if got := len(pool.Pending()); got != 1 {
+		t.Errorf("pool has %d pending transactions, want 1", got)
+	}
+}
+
+func TestMempoolAddOrReplace(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	newTx := func(amount, fee uint64) blockchain.Transaction {
+		tx, err := blockchain.NewFeeTransaction(me, you.PublicKey(), amount, fee, []byte("payment"))
+		if err != nil {
+			t.Fatalf("failed to create transaction: %s", err)
+		}
+		return tx
+	}
+
+	var pool blockchain.Mempool
+	if replaced, err := pool.AddOrReplace(newTx(5, 1)); replaced || err != nil {
+		t.Fatalf("AddOrReplace = %t, %v, want false, nil", replaced, err)
+	}
+	if replaced, err := pool.AddOrReplace(newTx(6, 1)); replaced || err != nil {
+		t.Fatalf("AddOrReplace of a different payment = %t, %v, want false, nil", replaced, err)
+	}
+
+	high := newTx(5, 3)
+	if replaced, err := pool.AddOrReplace(high); !replaced || err != nil {
+		t.Fatalf("AddOrReplace with a higher fee = %t, %v, want true, nil", replaced, err)
+	}
+	if replaced, err := pool.AddOrReplace(newTx(5, 2)); replaced || err == nil {
+		t.Errorf("AddOrReplace with a lower fee = %t, %v, want false and an error", replaced, err)
+	}
+
+	pending := pool.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("pool has %d pending transactions, want 2", len(pending))
+	}
+	if !pending[0].Equal(high) {
+		t.Errorf("pool kept the transaction with fee %d, want the one with fee %d", pending[0].Fee(), high.Fee())
+	}
+}
+
+func TestMempoolRejectsDuplicates(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	pool := blockchain.NewMempool(&chain)
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	if err := pool.Add(tx); err == nil {
+		t.Error("expected an error adding a transaction already in the pool")
+	}
+	if got := len(pool.Pending()); got != 1 {
+		t.Errorf("pool has %d pending transactions, want 1", got)
+	}
+
+	if block := chain.MineBlock(pool, 5); len(block.Transactions()) != 1 {
+		t.Fatalf("mined block has %d transactions, want 1", len(block.Transactions()))
+	}
+	if err := pool.Add(tx); err == nil {
+		t.Error("expected an error adding a transaction already on the chain")
+	}
+	if _, err := pool.AddOrReplace(tx); err == nil {
+		t.Error("expected an error replacing with a transaction already on the chain")
+	}
+}
+
+func TestMineBlockSkipsMined(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	first := chain.NewBlock()
+	if err := first.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	first.Mine(difficulty)
+
+	// A pool that isn't tied to the chain can't tell the transaction has been
+	// mined, so MineBlock has to.
+	var pool blockchain.Mempool
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	block := chain.MineBlock(&pool, 5)
+	if got := len(block.Transactions()); got != 0 {
+		t.Errorf("mined block has %d transactions, want 0", got)
+	}
+	if got := len(pool.Pending()); got != 0 {
+		t.Errorf("pool still has %d pending transactions", got)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Errorf("chain is not valid: %s", err)
+	}
+}
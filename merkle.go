@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+)
+
+// MerkleRoot returns the root of a binary Merkle tree built over the hashes
+// of the block's transactions, or nil if the block has no transactions. When
+// a level of the tree has an odd number of nodes, the last one is duplicated.
+func (b Block) MerkleRoot() []byte {
+	levels := b.merkleLevels()
+	if len(levels) == 0 {
+		return nil
+	}
+	return levels[len(levels)-1][0]
+}
+
+// MerkleProof returns the sibling hashes needed to prove that the transaction
+// with the given hash is included in the block, ordered from the leaf up to
+// the root. Use VerifyMerkleProof to check it.
+func (b Block) MerkleProof(txHash []byte) ([][]byte, error) {
+	levels := b.merkleLevels()
+	if len(levels) == 0 {
+		return nil, errors.New("blockchain.Block.MerkleProof: block has no transactions")
+	}
+
+	index := -1
+	for i, leaf := range levels[0] {
+		if bytes.Equal(leaf, txHash) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("blockchain.Block.MerkleProof: transaction not found in block")
+	}
+
+	var proof [][]byte
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		proof = append(proof, level[sibling])
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof returns true if proof, as returned by MerkleProof, shows
+// that leaf is included in the tree with the given root. The tree must have
+// been built with SHA-256, which is the default for blocks.
+func VerifyMerkleProof(root, leaf []byte, proof [][]byte) bool {
+	hash := leaf
+	for _, sibling := range proof {
+		hash = merkleParent(nil, hash, sibling)
+	}
+	return bytes.Equal(hash, root)
+}
+
+// merkleLevels builds the Merkle tree over the block's transactions, returning
+// each level starting with the leaves and ending with the root.
+func (b Block) merkleLevels() [][][]byte {
+	if len(b.transactions) == 0 {
+		return nil
+	}
+
+	level := make([][]byte, len(b.transactions))
+	for i, t := range b.transactions {
+		level[i] = t.Hash()
+	}
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, merkleParent(b.newHash, level[i], right))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// merkleParent hashes two sibling nodes together using newHash, or SHA-256 if
+// it's nil. The pair is sorted first so that proofs don't need to record which
+// side each sibling is on.
+func merkleParent(newHash func() hash.Hash, a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	hasher := newHasher(newHash)
+	hasher.Write(a)
+	hasher.Write(b)
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package blockchain_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for _, count := range []int{1, 2, 5} {
+		t.Run(strconv.Itoa(count), func(t *testing.T) {
+			block := blockWithTransactions(t, count)
+			root := block.MerkleRoot()
+			if root == nil {
+				t.Fatal("expected a merkle root")
+			}
+
+			for i, tx := range block.Transactions() {
+				proof, err := block.MerkleProof(tx.Hash())
+				if err != nil {
+					t.Fatalf("failed to build proof for transaction %d: %s", i, err)
+				}
+				if !blockchain.VerifyMerkleProof(root, tx.Hash(), proof) {
+					t.Errorf("proof for transaction %d did not verify", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleProofInvalid(t *testing.T) {
+	block := blockWithTransactions(t, 5)
+	other := blockWithTransactions(t, 1)
+
+	if _, err := block.MerkleProof(other.Transactions()[0].Hash()); err == nil {
+		t.Error("expected an error for a transaction not in the block")
+	}
+
+	proof, err := block.MerkleProof(block.Transactions()[0].Hash())
+	if err != nil {
+		t.Fatalf("failed to build proof: %s", err)
+	}
+	if blockchain.VerifyMerkleProof(block.MerkleRoot(), other.Transactions()[0].Hash(), proof) {
+		t.Error("proof verified for a transaction not in the block")
+	}
+}
+
+func TestVerifyTransactions(t *testing.T) {
+	const difficulty = 1
+
+	block := blockWithTransactions(t, 3)
+	block.Mine(difficulty)
+	if err := block.VerifyTransactions(); err != nil {
+		t.Fatalf("VerifyTransactions on a mined block: %s", err)
+	}
+
+	block.SetTransactionData(1, []byte("swapped after mining"))
+	err := block.VerifyTransactions()
+	if err == nil {
+		t.Fatal("VerifyTransactions succeeded after mutating a transaction")
+	}
+	if !strings.Contains(err.Error(), "transaction 1") {
+		t.Errorf("error %q does not name transaction 1", err)
+	}
+}
+
+func TestVerifyTransactionsSwapped(t *testing.T) {
+	const difficulty = 1
+
+	block := blockWithTransactions(t, 2)
+	block.Mine(difficulty)
+
+	other := blockWithTransactions(t, 1)
+	if err := block.AddTransaction(other.Transactions()[0]); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	if err := block.VerifyTransactions(); err == nil {
+		t.Error("VerifyTransactions succeeded after adding a transaction post-mining")
+	}
+}
+
+func blockWithTransactions(t *testing.T, count int) *blockchain.Block {
+	t.Helper()
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := blockchain.NewBlock(nil, nil)
+	for i := 0; i < count; i++ {
+		if err := block.SendTransaction(me, you.PublicKey(), []byte("transaction "+strconv.Itoa(i))); err != nil {
+			t.Fatalf("failed to send transaction: %s", err)
+		}
+	}
+	return block
+}
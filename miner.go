@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"context"
+	"sync"
+)
+
+// Miner mines blocks on a fixed pool of worker goroutines, which is useful for
+// mining many independent blocks at once. Its methods are safe for concurrent
+// use.
+type Miner struct {
+	// mu guards closed, and is held for reading while a job is queued so
+	// that Close can't close jobs underneath it.
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan minerJob
+	wg     sync.WaitGroup
+}
+
+// minerJob is a block queued for mining, along with the channel its hash is
+// delivered on.
+type minerJob struct {
+	block  *Block
+	result chan<- string
+}
+
+// NewMiner starts a Miner with the given number of workers, each mining one
+// block at a time. At least one worker is always started.
+func NewMiner(workers int) *Miner {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &Miner{jobs: make(chan minerJob, workers)}
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+func (m *Miner) work() {
+	defer m.wg.Done()
+	for job := range m.jobs {
+		hash, _ := job.block.MineContext(context.Background())
+		job.result <- hash
+		close(job.result)
+	}
+}
+
+// Submit queues b for mining at its current difficulty, returning a channel
+// that delivers the resulting hex-encoded hash once it's mined. If every
+// worker is busy and the queue is full, Submit waits for room. The block
+// mustn't be modified until its hash is delivered. Once the Miner is closed,
+// the returned channel is closed without delivering anything.
+func (m *Miner) Submit(b *Block) <-chan string {
+	result := make(chan string, 1)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		close(result)
+		return result
+	}
+	m.jobs <- minerJob{block: b, result: result}
+	return result
+}
+
+// Close stops accepting blocks, waits for every block already submitted to be
+// mined, and stops the workers.
+func (m *Miner) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.jobs)
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
@@ -0,0 +1,43 @@
+package blockchain_test
+
+import (
+	"strconv"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestMiner(t *testing.T) {
+	const difficulty = 2
+
+	miner := blockchain.NewMiner(3)
+	var (
+		blocks  []*blockchain.Block
+		results []<-chan string
+	)
+	for i := 0; i < 10; i++ {
+		block := blockchain.NewBlock(nil, []byte("candidate "+strconv.Itoa(i)))
+		block.SetDifficulty(difficulty)
+		blocks = append(blocks, block)
+		results = append(results, miner.Submit(block))
+	}
+	miner.Close()
+
+	for i, result := range results {
+		hash, ok := <-result
+		if !ok {
+			t.Fatalf("block %d: no hash delivered", i)
+		}
+		if hash != blocks[i].HashString() {
+			t.Errorf("block %d: delivered hash %s, want %s", i, hash, blocks[i].HashString())
+		}
+		if !blockchain.WorkProvenAt(hash, difficulty) {
+			t.Errorf("block %d: hash %s is not valid proof-of-work", i, hash)
+		}
+	}
+
+	if _, ok := <-miner.Submit(blockchain.NewBlock(nil, nil)); ok {
+		t.Error("closed miner delivered a hash")
+	}
+	miner.Close()
+}
@@ -0,0 +1,234 @@
+package blockchain
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"hash"
+	"sync"
+	"time"
+)
+
+// Option configures a Blockchain constructed with NewChain.
+type Option func(*Blockchain)
+
+// NewChain constructs a new Blockchain configured by the given options. By
+// default, the chain has a difficulty of zero, no retargeting, no limit on
+// transactions per block, rejects blocks timestamped more than
+// DefaultMaxFutureDrift ahead of the system clock, and creates identities on
+// the P-224 curve.
+func NewChain(opts ...Option) Blockchain {
+	c := Blockchain{
+		mu:             new(sync.RWMutex),
+		l:              list.New(),
+		utxo:           newUTXOSet(),
+		subs:           newSubscribers(),
+		index:          newTxIndex(),
+		maxFutureDrift: DefaultMaxFutureDrift,
+		now:            time.Now,
+		curve:          elliptic.P224(),
+		consensus:      ProofOfWork{},
+	}
+	c.setDifficulty(0)
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithDifficulty sets the chain's mining difficulty, or its initial
+// difficulty if retargeting is enabled.
+func WithDifficulty(difficulty int) Option {
+	return func(c *Blockchain) {
+		c.setDifficulty(difficulty)
+	}
+}
+
+// WithMaxTxPerBlock limits each block on the chain to at most max
+// transactions. A limit of zero means unlimited.
+func WithMaxTxPerBlock(max int) Option {
+	return func(c *Blockchain) {
+		c.maxTxPerBlock = max
+	}
+}
+
+// WithMaxBlockSize limits each block on the chain to at most max bytes, as
+// reported by Block.Size. A limit of zero means unlimited.
+func WithMaxBlockSize(max int) Option {
+	return func(c *Blockchain) {
+		c.maxBlockSize = max
+	}
+}
+
+// WithRequireData makes the chain's blocks reject transactions with no data,
+// so that SendTransaction and AddTransaction return an error for them. It's
+// off by default, since pure value transfers have no need for data. Blocks
+// received from elsewhere aren't checked.
+func WithRequireData(require bool) Option {
+	return func(c *Blockchain) {
+		c.requireData = require
+	}
+}
+
+// WithAllowedSenders restricts the chain to transactions sent by the given
+// public keys, for permissioned chains, so that SendTransaction and
+// AddTransaction return an error for anyone else and AppendBlock returns
+// ErrSenderNotAllowed. With no keys, which is the default, anyone may send
+// transactions.
+func WithAllowedSenders(keys ...*ecdsa.PublicKey) Option {
+	return func(c *Blockchain) {
+		c.allowedSenders = make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			c.allowedSenders[mustString(Transaction{sender: key}.SenderErr())] = struct{}{}
+		}
+	}
+}
+
+// senderAllowed returns true if t's sender is in allowed, or if allowed is
+// empty.
+func senderAllowed(allowed map[string]struct{}, t Transaction) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	sender, err := t.SenderErr()
+	if err != nil {
+		return false
+	}
+	_, ok := allowed[sender]
+	return ok
+}
+
+// DefaultMaxFutureDrift is the default limit on how far ahead of the current
+// time a block's timestamp may be.
+const DefaultMaxFutureDrift = 2 * time.Hour
+
+// WithMaxFutureDrift limits how far ahead of the current time a block's
+// timestamp may be. A limit of zero means unlimited.
+func WithMaxFutureDrift(drift time.Duration) Option {
+	return func(c *Blockchain) {
+		c.maxFutureDrift = drift
+	}
+}
+
+// WithClock sets the function the chain uses to get the current time, which
+// is time.Now by default. It's used to timestamp the blocks created by the
+// chain, along with transactions sent with Block.SendTransaction, and to check
+// timestamps during validation.
+func WithClock(now func() time.Time) Option {
+	return func(c *Blockchain) {
+		c.now = now
+	}
+}
+
+// WithTargetInterval enables difficulty retargeting, aiming for one block
+// every interval. It has no effect unless WithRetargetWindow is also given.
+// See NewWithTarget for details.
+func WithTargetInterval(interval time.Duration) Option {
+	return func(c *Blockchain) {
+		c.targetInterval = interval
+	}
+}
+
+// WithRetargetWindow sets the number of blocks whose timestamps are compared
+// against the target interval when retargeting.
+func WithRetargetWindow(window int) Option {
+	return func(c *Blockchain) {
+		c.window = window
+	}
+}
+
+// WithCurve sets the elliptic curve used for identities created with the
+// chain's NewIdentity method.
+func WithCurve(curve elliptic.Curve) Option {
+	return func(c *Blockchain) {
+		c.curve = curve
+	}
+}
+
+// WithHasher sets the hash function used for blocks and transactions on the
+// chain. Transactions are still signed over a SHA-256 signing hash, so that
+// they can be signed without knowing the chain's hash function. Chains using
+// anything but the default of SHA-256 must be decoded with DecodeWithHasher.
+func WithHasher(newHash func() hash.Hash) Option {
+	return func(c *Blockchain) {
+		c.newHash = newHash
+	}
+}
+
+// WithConsensus sets the consensus used to prove and validate the chain's
+// blocks, which is ProofOfWork by default. Like the hash function, it isn't
+// encoded with the chain, and Decode assumes proof-of-work.
+func WithConsensus(consensus Consensus) Option {
+	return func(c *Blockchain) {
+		c.consensus = consensus
+	}
+}
+
+// setDifficulty sets the chain's difficulty along with the proof-of-work
+// prefix and target derived from it, which must never be set separately.
+func (c *Blockchain) setDifficulty(difficulty int) {
+	c.difficulty = difficulty
+	c.proofPrefix = proofPrefix(difficulty)
+	c.target = difficultyTarget(difficulty)
+}
+
+// Difficulty returns the chain's mining difficulty, or its initial difficulty
+// if retargeting is enabled. See NextDifficulty for the difficulty required of
+// the next block.
+func (c Blockchain) Difficulty() int {
+	return c.difficulty
+}
+
+// ProofPrefix returns the prefix every hex-encoded hash that counts as
+// proof-of-work at the chain's difficulty starts with. Difficulty is measured
+// in bits, so this is only a sufficient condition when it's a multiple of
+// four; use WorkProven to check a hash.
+func (c Blockchain) ProofPrefix() string {
+	return c.proofPrefix
+}
+
+// MaxTxPerBlock returns the maximum number of transactions allowed in each
+// block, or zero if there is no limit.
+func (c Blockchain) MaxTxPerBlock() int {
+	return c.maxTxPerBlock
+}
+
+// MaxBlockSize returns the maximum size in bytes allowed for each block, or
+// zero if there is no limit.
+func (c Blockchain) MaxBlockSize() int {
+	return c.maxBlockSize
+}
+
+// RequireData returns true if the chain's blocks reject transactions with no
+// data.
+func (c Blockchain) RequireData() bool {
+	return c.requireData
+}
+
+// MaxFutureDrift returns how far ahead of the current time a block's
+// timestamp may be, or zero if there is no limit.
+func (c Blockchain) MaxFutureDrift() time.Duration {
+	return c.maxFutureDrift
+}
+
+// TargetInterval returns the block interval targeted by retargeting, or zero
+// if retargeting is disabled.
+func (c Blockchain) TargetInterval() time.Duration {
+	return c.targetInterval
+}
+
+// RetargetWindow returns the number of blocks considered when retargeting.
+func (c Blockchain) RetargetWindow() int {
+	return c.window
+}
+
+// Curve returns the elliptic curve used for identities created with the
+// chain's NewIdentity method.
+func (c Blockchain) Curve() elliptic.Curve {
+	return c.curve
+}
+
+// NewIdentity constructs a new identity on the chain's curve.
+func (c Blockchain) NewIdentity() (Identity, error) {
+	return NewIdentityWithCurve(c.curve)
+}
@@ -0,0 +1,215 @@
+package blockchain_test
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestNewChainOptions(t *testing.T) {
+	chain := blockchain.NewChain(
+		blockchain.WithDifficulty(3),
+		blockchain.WithMaxTxPerBlock(5),
+		blockchain.WithMaxBlockSize(1024),
+		blockchain.WithMaxFutureDrift(time.Hour),
+		blockchain.WithTargetInterval(time.Minute),
+		blockchain.WithRetargetWindow(4),
+		blockchain.WithCurve(elliptic.P256()),
+	)
+
+	if got := chain.NextDifficulty(); got != 3 {
+		t.Errorf("difficulty = %d, want 3", got)
+	}
+	if got := chain.MaxTxPerBlock(); got != 5 {
+		t.Errorf("max transactions per block = %d, want 5", got)
+	}
+	if got := chain.MaxBlockSize(); got != 1024 {
+		t.Errorf("max block size = %d, want 1024", got)
+	}
+	if got := chain.MaxFutureDrift(); got != time.Hour {
+		t.Errorf("max future drift = %s, want %s", got, time.Hour)
+	}
+	if got := chain.TargetInterval(); got != time.Minute {
+		t.Errorf("target interval = %s, want %s", got, time.Minute)
+	}
+	if got := chain.RetargetWindow(); got != 4 {
+		t.Errorf("retarget window = %d, want 4", got)
+	}
+	if got := chain.Curve(); got != elliptic.P256() {
+		t.Errorf("curve = %s, want %s", got.Params().Name, elliptic.P256().Params().Name)
+	}
+
+	identity, err := chain.NewIdentity()
+	if err != nil {
+		t.Fatalf("failed to create identity: %s", err)
+	}
+	if identity.PublicKey().Curve != elliptic.P256() {
+		t.Errorf("identity curve = %s, want %s", identity.PublicKey().Curve.Params().Name, elliptic.P256().Params().Name)
+	}
+}
+
+func TestWithRequireData(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+
+	permissive := blockchain.New(0)
+	if permissive.RequireData() {
+		t.Error("chains should not require data by default")
+	}
+	if err := permissive.NewBlock().SendTransaction(me, you.PublicKey(), nil); err != nil {
+		t.Errorf("failed to send a transaction with no data: %s", err)
+	}
+
+	strict := blockchain.NewChain(blockchain.WithRequireData(true))
+	if !strict.RequireData() {
+		t.Error("chain should require data")
+	}
+	block := strict.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), nil); err == nil {
+		t.Error("expected an error sending a transaction with no data")
+	}
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte{})
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if err := block.AddTransaction(tx); err == nil {
+		t.Error("expected an error adding a transaction with no data")
+	}
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("something")); err != nil {
+		t.Errorf("failed to send a transaction with data: %s", err)
+	}
+	if got := len(block.Transactions()); got != 1 {
+		t.Errorf("block has %d transactions, want 1", got)
+	}
+}
+
+func TestWithAllowedSenders(t *testing.T) {
+	const difficulty = 1
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	chain := blockchain.NewChain(blockchain.WithDifficulty(difficulty), blockchain.WithAllowedSenders(me.PublicKey()))
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("allowed")); err != nil {
+		t.Errorf("failed to send a transaction from an allowed sender: %s", err)
+	}
+	err := block.SendTransaction(you, me.PublicKey(), []byte("not allowed"))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected an error sending from a disallowed sender, got %v", err)
+	}
+	if got := len(block.Transactions()); got != 1 {
+		t.Errorf("block has %d transactions, want 1", got)
+	}
+
+	// Blocks from elsewhere are checked when they're appended.
+	block.Mine(difficulty)
+	tip, _ := chain.Tip()
+	peer := blockchain.NewBlock(tip.Hash(), []byte("from a peer"))
+	if err := peer.SendTransaction(you, me.PublicKey(), []byte("not allowed")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	peer.Mine(difficulty)
+	if err := chain.AppendBlock(peer); err != blockchain.ErrSenderNotAllowed {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrSenderNotAllowed)
+	}
+
+	peer = blockchain.NewBlock(tip.Hash(), []byte("from a peer"))
+	if err := peer.SendTransaction(me, you.PublicKey(), []byte("allowed")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	peer.Mine(difficulty)
+	if err := chain.AppendBlock(peer); err != nil {
+		t.Errorf("failed to append a block from an allowed sender: %s", err)
+	}
+
+	// Without any allowed senders, anyone may send transactions.
+	open := blockchain.NewChain(blockchain.WithAllowedSenders())
+	if err := open.NewBlock().SendTransaction(you, me.PublicKey(), []byte("anyone")); err != nil {
+		t.Errorf("failed to send a transaction on a permissionless chain: %s", err)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	const difficulty = 4
+
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		chain := blockchain.NewChain(blockchain.WithDifficulty(difficulty), blockchain.WithClock(clock))
+		block := chain.Add([]byte("same data"))
+		if got := block.Timestamp(); !got.Equal(now) {
+			t.Errorf("block timestamp = %s, want %s", got, now)
+		}
+		hashes = append(hashes, block.HashString())
+	}
+	// Blocks without transactions have nothing random in them, so the same
+	// clock and data always produce the same block.
+	if hashes[0] != hashes[1] {
+		t.Errorf("blocks mined at the same time with the same data have hashes %s and %s", hashes[0], hashes[1])
+	}
+
+	chain := blockchain.NewChain(blockchain.WithClock(clock))
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	block := chain.NewBlock()
+	if err := block.SendTransaction(me, you.PublicKey(), []byte("tick")); err != nil {
+		t.Fatalf("failed to send transaction: %s", err)
+	}
+	if got := block.Transactions()[0].Timestamp(); !got.Equal(now) {
+		t.Errorf("transaction timestamp = %s, want %s", got, now)
+	}
+}
+
+func TestDifficultyAccessors(t *testing.T) {
+	const difficulty = 8
+
+	chain := blockchain.New(difficulty)
+	if got := chain.Difficulty(); got != difficulty {
+		t.Errorf("chain difficulty = %d, want %d", got, difficulty)
+	}
+	if got := chain.ProofPrefix(); got != "00" {
+		t.Errorf("proof prefix = %q, want %q", got, "00")
+	}
+	if got := chain.Add([]byte("block")).Difficulty(); got != difficulty {
+		t.Errorf("block difficulty = %d, want %d", got, difficulty)
+	}
+}
+
+func TestSetDifficulty(t *testing.T) {
+	chain := blockchain.New(4)
+	chain.SetDifficulty(12)
+
+	if got := chain.ProofPrefix(); got != "000" {
+		t.Errorf("proof prefix = %q, want %q", got, "000")
+	}
+	if got, want := chain.Target(), new(big.Int).Lsh(big.NewInt(1), 256-12); got.Cmp(want) != 0 {
+		t.Errorf("target = %x, want %x", got, want)
+	}
+	// Eight zero bits were enough at the old difficulty, but not the new one.
+	if hash := "00f" + strings.Repeat("f", 61); chain.WorkProven(hash) {
+		t.Errorf("hash %s counts as proof-of-work at difficulty 12", hash)
+	}
+	if hash := "000f" + strings.Repeat("f", 60); !chain.WorkProven(hash) {
+		t.Errorf("hash %s does not count as proof-of-work at difficulty 12", hash)
+	}
+}
+
+func TestNewChainDefaults(t *testing.T) {
+	chain := blockchain.NewChain()
+
+	if got := chain.NextDifficulty(); got != 0 {
+		t.Errorf("difficulty = %d, want 0", got)
+	}
+	if got := chain.MaxTxPerBlock(); got != 0 {
+		t.Errorf("max transactions per block = %d, want 0", got)
+	}
+	if got := chain.TargetInterval(); got != 0 {
+		t.Errorf("target interval = %s, want 0", got)
+	}
+	if got := chain.Curve(); got != elliptic.P224() {
+		t.Errorf("curve = %s, want %s", got.Params().Name, elliptic.P224().Params().Name)
+	}
+}
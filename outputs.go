@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+// Output is one of the payments made by a transaction with multiple
+// recipients.
+type Output struct {
+	Receiver *ecdsa.PublicKey
+	Amount   uint64
+}
+
+// NewMultiTransaction constructs a transaction paying each of the outputs
+// from the identity "from" in a single transfer, along with some arbitrary
+// data. Its receiver is the first output's receiver, and its amount is the
+// total of the outputs. The transaction's signing hash commits to every
+// output, so the signature covers them all. The transaction is automatically
+// signed, returning an error if signing fails.
+func NewMultiTransaction(from Identity, outputs []Output, data []byte) (Transaction, error) {
+	if len(outputs) == 0 {
+		return Transaction{}, errors.New("blockchain.NewMultiTransaction: no outputs")
+	}
+	var total uint64
+	for _, o := range outputs {
+		if o.Receiver == nil {
+			return Transaction{}, errors.New("blockchain.NewMultiTransaction: output has no receiver")
+		}
+		if o.Amount > math.MaxUint64-total {
+			return Transaction{}, errors.New("blockchain.NewMultiTransaction: outputs overflow")
+		}
+		total += o.Amount
+	}
+	return newTransaction("blockchain.NewMultiTransaction", from, Transaction{
+		kind:     TxTransfer,
+		receiver: outputs[0].Receiver,
+		amount:   total,
+		outputs:  slices.Clone(outputs),
+		data:     data,
+	})
+}
+
+// Outputs returns the payments made by the transaction. A transaction
+// constructed with NewMultiTransaction has one for each of its receivers; any
+// other has a single output paying its amount to its receiver.
+func (t Transaction) Outputs() []Output {
+	if len(t.outputs) == 0 {
+		return []Output{{Receiver: t.receiver, Amount: t.amount}}
+	}
+	return slices.Clone(t.outputs)
+}
+
+// appendOutputs appends the outputs of a transaction with multiple recipients
+// to buf, each as its receiver's public key in PKIX form prefixed by its
+// length, followed by its amount, using the given byte order. Nothing is
+// appended for any other transaction.
+func (t Transaction) appendOutputs(buf []byte, order binary.AppendByteOrder) ([]byte, error) {
+	for _, o := range t.outputs {
+		der, err := x509.MarshalPKIXPublicKey(o.Receiver)
+		if err != nil {
+			return nil, errors.New("invalid output receiver: " + err.Error())
+		}
+		buf = appendBytes(buf, der)
+		buf = order.AppendUint64(buf, o.Amount)
+	}
+	return buf, nil
+}
+
+// outputsEqual returns true if a and b pay the same amounts to the same
+// receivers in the same order.
+func outputsEqual(a, b Output) bool {
+	return keysEqual(a.Receiver, b.Receiver) && a.Amount == b.Amount
+}
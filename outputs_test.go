@@ -0,0 +1,84 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestMultiTransaction(t *testing.T) {
+	me := mustIdentity(blockchain.NewIdentity())
+	alice, bob := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	outputs := []blockchain.Output{
+		{Receiver: alice.PublicKey(), Amount: 3},
+		{Receiver: bob.PublicKey(), Amount: 5},
+	}
+	tx, err := blockchain.NewMultiTransaction(me, outputs, []byte("split"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if !tx.Verify() {
+		t.Error("multi-output transaction does not verify")
+	}
+	if tx.Amount() != 8 {
+		t.Errorf("amount = %d, want the total of 8", tx.Amount())
+	}
+
+	var pool blockchain.Mempool
+	if err := pool.Add(tx); err != nil {
+		t.Fatalf("failed to add transaction to pool: %s", err)
+	}
+	chain := blockchain.New(0)
+	chain.MineBlock(&pool, 1)
+	for _, c := range []struct {
+		name string
+		id   blockchain.Identity
+		want int64
+	}{
+		{"alice", alice, 3},
+		{"bob", bob, 5},
+		{"sender", me, -8},
+	} {
+		if got := chain.Balance(c.id.PublicKey()); got != c.want {
+			t.Errorf("%s: Balance = %d, want %d", c.name, got, c.want)
+		}
+		if got := chain.UTXO().Balance(c.id.PublicKey()); got != c.want {
+			t.Errorf("%s: UTXO balance = %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	// Both encodings keep the outputs.
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+	decoded, err := blockchain.UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal transaction: %s", err)
+	}
+	if !decoded.Equal(tx) || !decoded.Verify() {
+		t.Error("transaction did not survive a binary round trip")
+	}
+	var buf bytes.Buffer
+	if err := chain.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode chain: %s", err)
+	}
+	decodedChain, err := blockchain.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode chain: %s", err)
+	}
+	if !decodedChain.Valid() || decodedChain.Balance(bob.PublicKey()) != 5 {
+		t.Error("chain did not survive an encoding round trip")
+	}
+
+	// The signature covers every output.
+	tx.SetOutputAmount(1, 50)
+	if tx.Verify() {
+		t.Error("transaction verifies after an output was changed")
+	}
+
+	if _, err := blockchain.NewMultiTransaction(me, nil, nil); err == nil {
+		t.Error("expected an error for a transaction without outputs")
+	}
+}
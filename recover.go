@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+	"strconv"
+)
+
+// RecoverPublicKey recovers the P-224 public key that produced the signature
+// (r, s) over hash, as made by Transaction.Sign over the transaction's
+// SigningHash. A signature matches up to four public keys, so recoveryID picks
+// the right one: its low bit is the parity of the y coordinate of the point
+// the signature was made with, and its second bit is set if that point's x
+// coordinate overflowed the curve's order.
+func RecoverPublicKey(hash []byte, r, s *big.Int, recoveryID byte) (*ecdsa.PublicKey, error) {
+	return RecoverPublicKeyWithCurve(elliptic.P224(), hash, r, s, recoveryID)
+}
+
+// RecoverPublicKeyWithCurve is like RecoverPublicKey, but recovers a public
+// key on the given curve.
+func RecoverPublicKeyWithCurve(curve elliptic.Curve, hash []byte, r, s *big.Int, recoveryID byte) (*ecdsa.PublicKey, error) {
+	pub, err := recoverPublicKey(curve, hash, r, s, recoveryID)
+	if err != nil {
+		return nil, errors.New("blockchain.RecoverPublicKey: " + err.Error())
+	}
+	return pub, nil
+}
+
+// recoverPublicKey does the work of RecoverPublicKeyWithCurve. The key is
+// Q = r⁻¹(sR - eG), where R is the point the signature was made with and e is
+// the hash as an integer.
+func recoverPublicKey(curve elliptic.Curve, hash []byte, r, s *big.Int, recoveryID byte) (*ecdsa.PublicKey, error) {
+	if curve == nil || curve.Params() == nil || curve.Params().N == nil || curve.Params().P == nil {
+		return nil, errors.New("curve doesn't support key recovery")
+	}
+	if recoveryID > 3 {
+		return nil, errors.New("invalid recovery id " + strconv.Itoa(int(recoveryID)))
+	}
+	params := curve.Params()
+	n := params.N
+	if r == nil || s == nil || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, errors.New("invalid signature")
+	}
+
+	// R's x coordinate is r, or r+n if it was at least the order.
+	x := new(big.Int).Set(r)
+	if recoveryID&2 != 0 {
+		x.Add(x, n)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, errors.New("invalid recovery id for signature")
+	}
+	compressed := make([]byte, 1+(params.BitSize+7)/8)
+	compressed[0] = 2 | recoveryID&1
+	x.FillBytes(compressed[1:])
+	rx, ry := elliptic.UnmarshalCompressed(curve, compressed)
+	if rx == nil {
+		return nil, errors.New("signature doesn't correspond to a point on the curve")
+	}
+
+	rInv := new(big.Int).ModInverse(r, n)
+	e := hashToInt(hash, n)
+	u1 := e.Neg(e).Mul(e, rInv).Mod(e, n)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, n)
+
+	x1, y1 := curve.ScalarBaseMult(u1.Bytes())
+	x2, y2 := curve.ScalarMult(rx, ry, u2.Bytes())
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errors.New("signature recovers the point at infinity")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}, nil
+}
+
+// recoveryIDFor returns the recovery id of the signature (r, s) over hash made
+// by pub, or false if the signature wasn't made by it.
+func recoveryIDFor(pub *ecdsa.PublicKey, hash []byte, r, s *big.Int) (byte, bool) {
+	if pub == nil {
+		return 0, false
+	}
+	for id := byte(0); id < 4; id++ {
+		if key, err := recoverPublicKey(pub.Curve, hash, r, s, id); err == nil && key.Equal(pub) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// lowS returns s, or n - s if s is in the upper half of the curve's order n.
+// Both make equally valid signatures, so requiring the lower half makes each
+// signature canonical, and keeps anyone without the signer's key from changing
+// a transaction's signature, and with it its hash.
+func lowS(curve elliptic.Curve, s *big.Int) *big.Int {
+	if isLowS(curve, s) {
+		return s
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
+
+// canonicalRecoveryID returns the recovery id of the signature (r, s) over
+// hash made by pub, and whether the signature is in canonical form: s must be
+// in the lower half of the curve's order and the recovery id must be even.
+// Negating s flips the parity of the recovery id, so of the signatures that
+// can be made from r and s, each verifying against some key recovered from
+// them, only one is canonical, and neither the signature nor the sender
+// recovered from it can be changed without the sender's key. If no recovery
+// id recovers pub, as on a curve that doesn't support key recovery, the id is
+// zero and only a low s is required.
+func canonicalRecoveryID(pub *ecdsa.PublicKey, hash []byte, r, s *big.Int) (byte, bool) {
+	if !isLowS(pub.Curve, s) {
+		return 0, false
+	}
+	id, ok := recoveryIDFor(pub, hash, r, s)
+	return id, !ok || id&1 == 0
+}
+
+// isLowS returns true if s is in the lower half of the curve's order.
+func isLowS(curve elliptic.Curve, s *big.Int) bool {
+	half := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(half) <= 0
+}
+
+// hashToInt converts hash to an integer the way ECDSA does, keeping only as
+// many of its leftmost bits as the order n has.
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	e := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - orderBits; excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+	return e
+}
@@ -0,0 +1,197 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestRecoverPublicKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		name := curve.Params().Name
+		me := mustIdentity(blockchain.NewIdentityWithCurve(curve))
+		you := mustIdentity(blockchain.NewIdentityWithCurve(curve))
+		for i := 0; i < 8; i++ {
+			tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), uint64(i), nil)
+			if err != nil {
+				t.Fatalf("%s: failed to create transaction: %s", name, err)
+			}
+			r, s, _ := tx.Signature()
+			pub, err := blockchain.RecoverPublicKeyWithCurve(curve, tx.SigningHash(), r, s, tx.RecoveryID())
+			if err != nil {
+				t.Fatalf("%s: failed to recover public key: %s", name, err)
+			}
+			if !pub.Equal(me.PublicKey()) {
+				t.Errorf("%s: recovered key does not equal the sender's", name)
+			}
+		}
+	}
+
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	r, s, _ := tx.Signature()
+	pub, err := blockchain.RecoverPublicKey(tx.SigningHash(), r, s, tx.RecoveryID())
+	if err != nil {
+		t.Fatalf("failed to recover public key: %s", err)
+	}
+	if !pub.Equal(me.PublicKey()) {
+		t.Error("recovered key does not equal the sender's")
+	}
+	if pub, err := blockchain.RecoverPublicKey(tx.SigningHash(), r, s, tx.RecoveryID()^1); err == nil && pub.Equal(me.PublicKey()) {
+		t.Error("recovered the sender's key with the wrong recovery id")
+	}
+}
+
+func TestRecoverPublicKeyErrors(t *testing.T) {
+	hash := make([]byte, 32)
+	one := big.NewInt(1)
+	for _, c := range []struct {
+		name       string
+		curve      elliptic.Curve
+		r, s       *big.Int
+		recoveryID byte
+	}{
+		{"nil curve", nil, one, one, 0},
+		{"bad recovery id", elliptic.P224(), one, one, 4},
+		{"missing signature", elliptic.P224(), nil, nil, 0},
+		{"zero signature", elliptic.P224(), new(big.Int), one, 0},
+		{"signature out of range", elliptic.P224(), elliptic.P224().Params().N, one, 0},
+	} {
+		if _, err := blockchain.RecoverPublicKeyWithCurve(c.curve, hash, c.r, c.s, c.recoveryID); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func TestTransactionRecoveredSender(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 7, []byte("who sent this?"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+	sender, _ := hex.DecodeString(tx.Sender())
+	if bytes.Contains(data, sender) {
+		t.Error("encoding includes the sender, which can be recovered")
+	}
+
+	decoded, err := blockchain.UnmarshalTransaction(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal transaction: %s", err)
+	}
+	if !decoded.Verify() {
+		t.Error("decoded transaction does not verify")
+	}
+	if decoded.Sender() != tx.Sender() {
+		t.Error("decoded transaction has a different sender")
+	}
+
+	// The sender is assumed to share the receiver's curve, so it has to be
+	// kept when they differ.
+	other := mustIdentity(blockchain.NewIdentityWithCurve(elliptic.P256()))
+	tx, err = blockchain.NewValueTransaction(other, you.PublicKey(), 7, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if data, err = tx.MarshalBinary(); err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+	if decoded, err = blockchain.UnmarshalTransaction(data); err != nil {
+		t.Fatalf("failed to unmarshal transaction: %s", err)
+	}
+	if !decoded.Verify() || decoded.Sender() != tx.Sender() {
+		t.Error("transaction with a sender on another curve did not survive encoding")
+	}
+}
+
+func TestTransactionSenderForgery(t *testing.T) {
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 7, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+
+	// The signature also verifies against the key recovered with the other
+	// recovery id, so claiming that key as the sender has to change the hash.
+	r, s, _ := tx.Signature()
+	other, err := blockchain.RecoverPublicKey(tx.SigningHash(), r, s, tx.RecoveryID()^1)
+	if err != nil {
+		t.Fatalf("failed to recover alternate key: %s", err)
+	}
+	forged := tx
+	forged.SetSender(other)
+	if bytes.Equal(forged.Hash(), tx.Hash()) {
+		t.Error("transaction with a different sender has the same hash")
+	}
+
+	// (r, n - s) is just as valid a signature, so only one of them is
+	// accepted, or the hash could be changed without the sender's key.
+	if s.Cmp(new(big.Int).Rsh(elliptic.P224().Params().N, 1)) > 0 {
+		t.Fatal("signature is not in canonical form")
+	}
+	highS := new(big.Int).Sub(elliptic.P224().Params().N, s)
+	malleated := tx
+	malleated.SetRawSignature(r, highS)
+	if malleated.Verify() {
+		t.Error("transaction with a non-canonical signature verifies")
+	}
+	malleated.SetSignature(r, highS)
+	if !malleated.Verify() || !bytes.Equal(malleated.Hash(), tx.Hash()) {
+		t.Error("SetSignature did not put the signature in canonical form")
+	}
+}
+
+func TestTransactionRecoveryIDReplay(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	me, you := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 5, nil)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	first := chain.NewBlock()
+	if err := first.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	first.Mine(difficulty)
+
+	// The recovery id is the last byte of the encoding. Flipping it recovers a
+	// different sender that the signature also verifies against, and changes
+	// the hash, so it mustn't be accepted as a new transaction.
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal transaction: %s", err)
+	}
+	data[len(data)-1] ^= 1
+	replayed, err := blockchain.UnmarshalTransaction(data)
+	if err != nil {
+		return
+	}
+	if bytes.Equal(replayed.Hash(), tx.Hash()) {
+		t.Fatal("flipping the recovery id did not change the hash")
+	}
+	if replayed.Verify() {
+		t.Error("transaction with a flipped recovery id verifies")
+	}
+
+	replay := blockchain.NewBlock(first.Hash(), nil)
+	if err := replay.AddTransaction(tx); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	replay.SetTransaction(0, replayed)
+	replay.Mine(difficulty)
+	if err := chain.AppendBlock(replay); err != blockchain.ErrInvalidSignature {
+		t.Errorf("AppendBlock error = %v, want %v", err, blockchain.ErrInvalidSignature)
+	}
+}
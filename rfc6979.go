@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// signRFC6979 signs hash with key, deriving the nonce from the key and hash
+// with HMAC-SHA-256 as described in RFC 6979 section 3.2 rather than reading
+// it from a random source, so the same key and hash always give the same
+// signature. It's implemented here rather than relying on crypto/ecdsa, which
+// only signs deterministically from Go 1.24. If accept isn't nil, signatures
+// it returns false for are skipped in the same way as those with a zero r or s,
+// so the result is still deterministic.
+func signRFC6979(key *ecdsa.PrivateKey, hash []byte, accept func(r, s *big.Int) bool) (r, s *big.Int, err error) {
+	curve := key.Curve
+	n := curve.Params().N
+	if key.D == nil || key.D.Sign() <= 0 || key.D.Cmp(n) >= 0 {
+		return nil, nil, errors.New("invalid private key")
+	}
+	size := (n.BitLen() + 7) / 8
+	e := hashToInt(hash, n)
+
+	// bits2octets: the hash as an integer reduced modulo n.
+	h1 := new(big.Int).Mod(e, n)
+	seed := append(new(big.Int).Set(key.D).FillBytes(make([]byte, size)), h1.FillBytes(make([]byte, size))...)
+
+	mac := func(k []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, k)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0x00}, seed)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, seed)
+	v = mac(k, v)
+
+	for {
+		var t []byte
+		for len(t) < size {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		// bits2int: the leftmost bits of t, as many as n has.
+		nonce := hashToInt(t, n)
+		if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			x, _ := curve.ScalarBaseMult(nonce.FillBytes(make([]byte, size)))
+			r = new(big.Int).Mod(x, n)
+			if r.Sign() != 0 {
+				s = new(big.Int).Mul(r, key.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(nonce, n))
+				s.Mod(s, n)
+				if s.Sign() != 0 && (accept == nil || accept(r, s)) {
+					return r, s, nil
+				}
+			}
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
@@ -0,0 +1,59 @@
+package blockchain_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+// TestSignRFC6979 checks signatures against the SHA-256 test vectors for the
+// message "sample" in RFC 6979 appendix A.2.
+func TestSignRFC6979(t *testing.T) {
+	for _, c := range []struct {
+		curve   elliptic.Curve
+		x, r, s string
+	}{
+		{
+			elliptic.P224(),
+			"F220266E1105BFE3083E03EC7A3A654651F45E37167E88600BF257C1",
+			"61AA3DA010E8E8406C656BC477A7A7189895E7E840CDFE8FF42307BA",
+			"BC814050DAB5D23770879494F9E0A680DC1AF7161991BDE692B10101",
+		},
+		{
+			elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+	} {
+		name := c.curve.Params().Name
+		key := &ecdsa.PrivateKey{D: hexInt(t, c.x)}
+		key.Curve = c.curve
+		key.X, key.Y = c.curve.ScalarBaseMult(key.D.Bytes())
+
+		hash := sha256.Sum256([]byte("sample"))
+		r, s, err := blockchain.SignRFC6979(key, hash[:], nil)
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %s", name, err)
+		}
+		if r.Cmp(hexInt(t, c.r)) != 0 || s.Cmp(hexInt(t, c.s)) != 0 {
+			t.Errorf("%s: signature = (%X, %X), want (%s, %s)", name, r, s, c.r, c.s)
+		}
+		if !ecdsa.Verify(&key.PublicKey, hash[:], r, s) {
+			t.Errorf("%s: signature does not verify", name)
+		}
+	}
+}
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex integer %q", s)
+	}
+	return i
+}
@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+)
+
+// Signer signs digests with a private key on behalf of an Identity, so that the
+// key can be kept in a hardware security module or keystore instead of in
+// memory.
+type Signer interface {
+	// Public returns the public key matching the signer's private key.
+	Public() *ecdsa.PublicKey
+	// Sign returns an ECDSA signature of digest, which has already been
+	// hashed.
+	Sign(digest []byte) (r, s *big.Int, err error)
+}
+
+// keySigner is the Signer used by identities holding their private key in
+// memory, such as those created with NewIdentity.
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k keySigner) Public() *ecdsa.PublicKey {
+	return &k.key.PublicKey
+}
+
+func (k keySigner) Sign(digest []byte) (r, s *big.Int, err error) {
+	return ecdsa.Sign(rand.Reader, k.key, digest)
+}
+
+// NewIdentityFromSigner constructs an identity that signs through signer. The
+// identity never sees the private key, so it can't be exported with ExportPEM
+// or used with Transaction.SignDeterministic.
+func NewIdentityFromSigner(signer Signer) Identity {
+	return Identity{signer: signer}
+}
+
+// privateKey returns the identity's private key, or false if it's only
+// available through its signer.
+func (i Identity) privateKey() (*ecdsa.PrivateKey, bool) {
+	k, ok := i.signer.(keySigner)
+	return k.key, ok
+}
@@ -0,0 +1,122 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+// recordingSigner is a Signer that records every digest it signs.
+type recordingSigner struct {
+	key     *ecdsa.PrivateKey
+	digests [][]byte
+}
+
+func (s *recordingSigner) Public() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *recordingSigner) Sign(digest []byte) (r, sig *big.Int, err error) {
+	s.digests = append(s.digests, bytes.Clone(digest))
+	return ecdsa.Sign(rand.Reader, s.key, digest)
+}
+
+// failingSigner is a Signer that refuses to sign anything.
+type failingSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s failingSigner) Public() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (failingSigner) Sign(digest []byte) (r, s *big.Int, err error) {
+	return nil, nil, errors.New("refused")
+}
+
+func TestSignerErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	me, you := blockchain.NewIdentityFromSigner(failingSigner{key: key}), mustIdentity(blockchain.NewIdentity())
+	to := you.PublicKey()
+
+	for _, c := range []struct {
+		prefix string
+		create func() error
+	}{
+		{"blockchain.NewValueTransaction", func() error {
+			_, err := blockchain.NewValueTransaction(me, to, 1, nil)
+			return err
+		}},
+		{"blockchain.NewFeeTransaction", func() error {
+			_, err := blockchain.NewFeeTransaction(me, to, 1, 1, nil)
+			return err
+		}},
+		{"blockchain.NewMessageTransaction", func() error {
+			_, err := blockchain.NewMessageTransaction(me, to, []byte("hi"))
+			return err
+		}},
+		{"blockchain.NewContractTransaction", func() error {
+			_, err := blockchain.NewContractTransaction(me, to, 1, nil)
+			return err
+		}},
+		{"blockchain.NewMultiTransaction", func() error {
+			_, err := blockchain.NewMultiTransaction(me, []blockchain.Output{{Receiver: to, Amount: 1}}, nil)
+			return err
+		}},
+		{"blockchain.SendTransaction", func() error {
+			return blockchain.New(0).NewBlock().SendTransaction(me, to, []byte("hi"))
+		}},
+	} {
+		err := c.create()
+		if err == nil || !strings.HasPrefix(err.Error(), c.prefix+": ") {
+			t.Errorf("error = %v, want one prefixed by %q", err, c.prefix)
+		}
+	}
+}
+
+func TestNewIdentityFromSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	signer := &recordingSigner{key: key}
+	me, you := blockchain.NewIdentityFromSigner(signer), mustIdentity(blockchain.NewIdentity())
+	if !me.PublicKey().Equal(&key.PublicKey) {
+		t.Error("identity does not have its signer's public key")
+	}
+
+	tx, err := blockchain.NewValueTransaction(me, you.PublicKey(), 1, []byte("signed elsewhere"))
+	if err != nil {
+		t.Fatalf("failed to create transaction: %s", err)
+	}
+	if !tx.Verify() {
+		t.Error("transaction signed through a Signer does not verify")
+	}
+	// Sign asks again until the signature is canonical, but always for the
+	// same hash.
+	if len(signer.digests) == 0 {
+		t.Error("signer was not asked to sign")
+	}
+	for _, digest := range signer.digests {
+		if !bytes.Equal(digest, tx.SigningHash()) {
+			t.Errorf("signer was asked to sign %x, want the signing hash %x", digest, tx.SigningHash())
+		}
+	}
+
+	if _, err := me.ExportPEM(); err == nil {
+		t.Error("expected an error exporting an identity without its private key")
+	}
+	if err := tx.SignDeterministic(me); err == nil {
+		t.Error("expected an error signing deterministically without the private key")
+	}
+}
@@ -0,0 +1,65 @@
+package blockchain
+
+import "sync"
+
+// subscriptionBuffer is the number of blocks buffered for each subscriber
+// before further blocks are dropped.
+const subscriptionBuffer = 16
+
+// subscribers holds the channels returned by Subscribe. Its methods are safe
+// for concurrent use.
+type subscribers struct {
+	mu    sync.Mutex
+	next  int
+	chans map[int]chan *Block
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{chans: make(map[int]chan *Block)}
+}
+
+// Subscribe returns a channel that receives each block added to the chain
+// from now on, whether by Add, AppendBlock, or any other method, along with a
+// function that ends the subscription and closes the channel. Adding a block
+// never waits on a subscriber: up to subscriptionBuffer blocks are buffered
+// for each one, and any more are dropped until it catches up. Blocks created
+// with NewBlock are delivered as soon as they're added, before they're mined.
+func (c *Blockchain) Subscribe() (<-chan *Block, func()) {
+	return c.subs.subscribe()
+}
+
+func (s *subscribers) subscribe() (<-chan *Block, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.next
+	s.next++
+	ch := make(chan *Block, subscriptionBuffer)
+	s.chans[id] = ch
+	return ch, func() { s.unsubscribe(id) }
+}
+
+// unsubscribe ends the subscription with the given id, if it hasn't already
+// ended.
+func (s *subscribers) unsubscribe(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.chans[id]; ok {
+		delete(s.chans, id)
+		close(ch)
+	}
+}
+
+// publish delivers block to every subscriber with room for it.
+func (s *subscribers) publish(block *Block) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.chans {
+		select {
+		case ch <- block:
+		default:
+		}
+	}
+}
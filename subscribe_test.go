@@ -0,0 +1,68 @@
+package blockchain_test
+
+import (
+	"testing"
+	"time"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestSubscribe(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	blocks, unsubscribe := chain.Subscribe()
+	defer unsubscribe()
+
+	first := chain.Add([]byte("one"))
+	second := blockchain.NewBlock(first.Hash(), []byte("two"))
+	second.Mine(difficulty)
+	if err := chain.AppendBlock(second); err != nil {
+		t.Fatalf("failed to append block: %s", err)
+	}
+
+	for _, want := range []*blockchain.Block{first, second} {
+		select {
+		case got := <-blocks:
+			if got != want {
+				t.Errorf("received block %d, want block %d", got.Height(), want.Height())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for block %d", want.Height())
+		}
+	}
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	chain := blockchain.New(0)
+	blocks, unsubscribe := chain.Subscribe()
+	defer unsubscribe()
+
+	// Nobody is reading, so adding blocks must not wait for the subscriber.
+	for i := 0; i < 100; i++ {
+		chain.Add(nil)
+	}
+	if got := len(blocks); got == 0 || got == 100 {
+		t.Errorf("subscriber has %d buffered blocks, want some but not all", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	chain := blockchain.New(0)
+	blocks, unsubscribe := chain.Subscribe()
+	others, unsubscribeOthers := chain.Subscribe()
+	defer unsubscribeOthers()
+
+	unsubscribe()
+	unsubscribe()
+	chain.Add([]byte("unseen"))
+
+	if block, ok := <-blocks; ok {
+		t.Errorf("received block %d after unsubscribing", block.Height())
+	}
+	select {
+	case <-others:
+	case <-time.After(time.Second):
+		t.Error("other subscriber stopped receiving blocks")
+	}
+}
@@ -0,0 +1,41 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// BlockSummary is a compact description of a block, such as for listing
+// blocks in a block explorer without sending their transactions.
+type BlockSummary struct {
+	Height int `json:"height"`
+	// Hash and PrevHash are hex-encoded.
+	Hash      string    `json:"hash"`
+	PrevHash  string    `json:"prevHash"`
+	Timestamp time.Time `json:"timestamp"`
+	TxCount   int       `json:"txCount"`
+	Nonce     uint32    `json:"nonce"`
+}
+
+// Summary returns a summary of the block, with its timestamp in UTC. Its height
+// is only meaningful if the block is on a chain.
+func (b Block) Summary() BlockSummary {
+	return BlockSummary{
+		Height:    b.height,
+		Hash:      b.HashString(),
+		PrevHash:  hex.EncodeToString(b.prevHash),
+		Timestamp: b.Timestamp(),
+		TxCount:   len(b.transactions),
+		Nonce:     b.nonce,
+	}
+}
+
+// Summaries returns a summary of each block on the chain, in order.
+func (c Blockchain) Summaries() []BlockSummary {
+	blocks := c.blocks()
+	summaries := make([]BlockSummary, len(blocks))
+	for i, block := range blocks {
+		summaries[i] = block.Summary()
+	}
+	return summaries
+}
@@ -0,0 +1,37 @@
+package blockchain_test
+
+import (
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestSummaries(t *testing.T) {
+	chain, _ := chainWithTransactions(t, 3, 2)
+
+	summaries := chain.Summaries()
+	if len(summaries) != chain.Len() {
+		t.Fatalf("got %d summaries for %d blocks", len(summaries), chain.Len())
+	}
+	i := 0
+	for block := range chain.Blocks() {
+		want := blockchain.BlockSummary{
+			Height:    i,
+			Hash:      block.HashString(),
+			PrevHash:  summaries[0].PrevHash,
+			Timestamp: block.Timestamp(),
+			TxCount:   2,
+			Nonce:     block.Nonce(),
+		}
+		if i > 0 {
+			want.PrevHash = summaries[i-1].Hash
+		}
+		if summaries[i] != want {
+			t.Errorf("summary %d = %+v, want %+v", i, summaries[i], want)
+		}
+		i++
+	}
+	if summaries[0].PrevHash != "" {
+		t.Errorf("genesis summary has previous hash %q", summaries[0].PrevHash)
+	}
+}
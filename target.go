@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"math"
+	"math/big"
+)
+
+// MeetsTarget returns true if the raw hash, interpreted as a big-endian
+// integer, is below the chain's target. Hashes that aren't 256 bits long are
+// truncated or padded with zeros before being compared.
+func (c Blockchain) MeetsTarget(hash []byte) bool {
+	return meetsTarget(hash, c.target)
+}
+
+// Target returns the chain's proof-of-work target. A block's hash must be
+// below the target for it to count as proof-of-work.
+func (c Blockchain) Target() *big.Int {
+	return new(big.Int).Set(c.target)
+}
+
+// difficultyTarget returns the target corresponding to a difficulty. Being
+// below 2^(256-difficulty) is the same as having difficulty leading zero bits.
+func difficultyTarget(difficulty int) *big.Int {
+	const hashBits = 256
+
+	if difficulty < 0 {
+		difficulty = 0
+	}
+	if difficulty > hashBits {
+		return new(big.Int)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(hashBits-difficulty))
+}
+
+// EstimatedAttempts returns the expected number of hashes needed to mine a
+// block at the given difficulty. Difficulty counts leading zero bits, so each
+// hash succeeds with probability 2^-difficulty and this is 2^difficulty.
+// Negative difficulties are treated as zero.
+func EstimatedAttempts(difficulty int) float64 {
+	if difficulty < 0 {
+		difficulty = 0
+	}
+	return math.Ldexp(1, difficulty)
+}
+
+// EstimatedWork returns the expected number of hashes it took to mine every
+// block on the chain, according to EstimatedAttempts.
+func (c Blockchain) EstimatedWork() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var work float64
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		work += EstimatedAttempts(e.Value.(*Block).difficulty)
+	}
+	return work
+}
+
+// DifficultyHistory returns the difficulty each block on the chain was mined
+// at, front to back. Blocks may be mined above the difficulty required of
+// them, and with retargeting the requirement itself varies, so this can differ
+// from the chain's difficulty.
+func (c Blockchain) DifficultyHistory() []int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history := make([]int, 0, c.l.Len())
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		history = append(history, e.Value.(*Block).difficulty)
+	}
+	return history
+}
+
+// TotalWork returns the total work done to mine every block on the chain: the
+// sum of 2^difficulty over its blocks, which is the exact form of
+// EstimatedWork. Unlike the chain's length, it accounts for blocks mined at
+// different difficulties.
+func (c Blockchain) TotalWork() *big.Int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.totalWork()
+}
+
+// totalWork does the work of TotalWork. The caller must hold the chain's
+// lock.
+func (c Blockchain) totalWork() *big.Int {
+	work := new(big.Int)
+	for e := c.l.Front(); e != nil; e = e.Next() {
+		difficulty := e.Value.(*Block).difficulty
+		if difficulty < 0 {
+			difficulty = 0
+		}
+		work.Add(work, new(big.Int).Lsh(big.NewInt(1), uint(difficulty)))
+	}
+	return work
+}
+
+// meetsTarget returns true if the raw hash is below target. Targets are
+// relative to a 256-bit hash, so longer hashes are compared by their first
+// 256 bits and shorter ones are padded with zeros, which keeps the difficulty
+// a count of leading zero bits regardless of the hash function.
+func meetsTarget(hash []byte, target *big.Int) bool {
+	const hashBytes = 32
+
+	if len(hash) > hashBytes {
+		hash = hash[:hashBytes]
+	} else if len(hash) < hashBytes {
+		hash = append(cloneBytes(hash), make([]byte, hashBytes-len(hash))...)
+	}
+	return new(big.Int).SetBytes(hash).Cmp(target) < 0
+}
+
+// CompactToTarget expands a target in the compact "nBits" format used by
+// Bitcoin block headers. The high byte is an exponent giving the length of
+// the target in bytes, and the low 23 bits are its most significant bytes;
+// bit 23 is a sign bit.
+func CompactToTarget(nBits uint32) *big.Int {
+	exponent := uint(nBits >> 24)
+	mantissa := int64(nBits & 0x007fffff)
+
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+	if nBits&0x00800000 != 0 {
+		target.Neg(target)
+	}
+	return target
+}
+
+// TargetToCompact is the inverse of CompactToTarget. Precision beyond the
+// three most significant bytes of the target is lost.
+func TargetToCompact(target *big.Int) uint32 {
+	abs := new(big.Int).Abs(target)
+	size := uint((abs.BitLen() + 7) / 8)
+
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(abs.Uint64() << (8 * (3 - size)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(abs, 8*(size-3)).Uint64())
+	}
+	// The mantissa's high bit is the sign bit, so make room if it's set.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+
+	compact := uint32(size)<<24 | mantissa
+	if target.Sign() < 0 && mantissa != 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
@@ -0,0 +1,105 @@
+package blockchain_test
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestEstimatedAttempts(t *testing.T) {
+	// Difficulty counts bits, so it takes a difficulty of 8, or two hex
+	// digits, to expect 256 attempts.
+	for difficulty, want := range map[int]float64{-1: 1, 0: 1, 2: 4, 8: 256, 20: 1 << 20} {
+		if got := blockchain.EstimatedAttempts(difficulty); got != want {
+			t.Errorf("EstimatedAttempts(%d) = %g, want %g", difficulty, got, want)
+		}
+	}
+}
+
+func TestEstimatedWork(t *testing.T) {
+	chain := blockchain.New(2)
+	if got := chain.EstimatedWork(); got != 0 {
+		t.Errorf("empty chain has estimated work %g, want 0", got)
+	}
+	chain.Add(nil)
+	chain.Add(nil)
+	chain.SetDifficulty(3)
+	chain.Add(nil)
+	if got, want := chain.EstimatedWork(), float64(4+4+8); got != want {
+		t.Errorf("estimated work = %g, want %g", got, want)
+	}
+}
+
+func TestDifficultyHistory(t *testing.T) {
+	chain := blockchain.New(1)
+	if got := chain.DifficultyHistory(); len(got) != 0 {
+		t.Errorf("empty chain has difficulty history %v", got)
+	}
+	chain.Add(nil)
+	for _, difficulty := range []int{3, 2} {
+		tip, _ := chain.Tip()
+		block := blockchain.NewBlock(tip.Hash(), nil)
+		block.Mine(difficulty)
+		if err := chain.AppendBlock(block); err != nil {
+			t.Fatalf("failed to append block: %s", err)
+		}
+	}
+	chain.Add(nil)
+	if got, want := chain.DifficultyHistory(), []int{1, 3, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("difficulty history = %v, want %v", got, want)
+	}
+}
+
+func TestCompactToTarget(t *testing.T) {
+	for _, c := range []struct {
+		compact uint32
+		target  string
+	}{
+		// The difficulty-1 target of Bitcoin's genesis block.
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x1b0404cb, "404cb000000000000000000000000000000000000000000000000"},
+		{0x03123456, "123456"},
+		{0x02123400, "1234"},
+		{0x01120000, "12"},
+	} {
+		want, _ := new(big.Int).SetString(c.target, 16)
+		if got := blockchain.CompactToTarget(c.compact); got.Cmp(want) != 0 {
+			t.Errorf("CompactToTarget(%#08x) = %x, want %x", c.compact, got, want)
+		}
+		if got := blockchain.TargetToCompact(want); got != c.compact {
+			t.Errorf("TargetToCompact(%x) = %#08x, want %#08x", want, got, c.compact)
+		}
+	}
+}
+
+func TestTargetToCompactSignBit(t *testing.T) {
+	target := big.NewInt(0x80)
+	compact := blockchain.TargetToCompact(target)
+	if compact != 0x02008000 {
+		t.Errorf("TargetToCompact(%x) = %#08x, want %#08x", target, compact, 0x02008000)
+	}
+	if got := blockchain.CompactToTarget(compact); got.Cmp(target) != 0 {
+		t.Errorf("CompactToTarget(%#08x) = %x, want %x", compact, got, target)
+	}
+}
+
+func TestMinedHashMeetsTarget(t *testing.T) {
+	const difficulty = 10
+
+	chain := blockchain.New(difficulty)
+	block := chain.Add([]byte("below target"))
+	if !chain.MeetsTarget(block.Hash()) {
+		t.Errorf("mined hash %s is not below target %x", block.HashString(), chain.Target())
+	}
+	if new(big.Int).SetBytes(block.Hash()).Cmp(chain.Target()) >= 0 {
+		t.Errorf("mined hash %s is not below target %x", block.HashString(), chain.Target())
+	}
+
+	high := make([]byte, 32)
+	high[0] = 0xff
+	if chain.MeetsTarget(high) {
+		t.Error("a hash above the target meets it")
+	}
+}
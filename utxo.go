@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"sync"
+)
+
+// UTXOSet tracks the value held by each public key on a chain, so that
+// balances can be looked up without scanning every block. Its methods are
+// safe for concurrent use.
+type UTXOSet struct {
+	mu       sync.RWMutex
+	balances map[string]int64
+	// applied is the number of blocks from the front of the chain that are
+	// reflected in balances.
+	applied int
+}
+
+func newUTXOSet() *UTXOSet {
+	return &UTXOSet{balances: make(map[string]int64)}
+}
+
+// Balance returns the value held by pub, as of the last block applied to the
+// set. It agrees with Blockchain.Balance for the same blocks.
+func (u *UTXOSet) Balance(pub *ecdsa.PublicKey) int64 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.balances[utxoKey(pub)]
+}
+
+// apply credits and debits the value moved by the block's transactions,
+// including the fees paid to its miner.
+func (u *UTXOSet) apply(b *Block) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.move(b, 1)
+	u.applied++
+}
+
+// unapply reverses apply for the last block applied to the set.
+func (u *UTXOSet) unapply(b *Block) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.move(b, -1)
+	u.applied--
+}
+
+// move moves the value moved by the block, or reverses it if sign is -1. The
+// caller must hold u.mu.
+func (u *UTXOSet) move(b *Block, sign int64) {
+	if b.miner != nil {
+		u.balances[utxoKey(b.miner)] += sign * int64(b.TotalFees())
+	}
+	for _, a := range b.alloc {
+		u.balances[utxoKey(a.key)] += sign * int64(a.amount)
+	}
+	for _, t := range b.transactions {
+		for _, o := range t.Outputs() {
+			u.balances[utxoKey(o.Receiver)] += sign * int64(o.Amount)
+		}
+		u.balances[utxoKey(t.sender)] -= sign * int64(t.amount+t.fee)
+	}
+}
+
+// reset empties the set, so that it no longer reflects any blocks.
+func (u *UTXOSet) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.balances = make(map[string]int64)
+	u.applied = 0
+}
+
+func (u *UTXOSet) clone() *UTXOSet {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	clone := &UTXOSet{balances: make(map[string]int64, len(u.balances)), applied: u.applied}
+	for k, v := range u.balances {
+		clone.balances[k] = v
+	}
+	return clone
+}
+
+// utxoKey returns the key under which pub's balance is stored.
+func utxoKey(pub *ecdsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	return string(der)
+}
+
+// UTXO returns the chain's UTXO set, updated to reflect every block on the
+// chain. AppendBlock keeps the set up to date as blocks arrive; blocks
+// created with NewBlock are filled in after they're added, so they're only
+// applied once UTXO or AppendBlock is next called, and should be finished
+// before then.
+func (c *Blockchain) UTXO() *UTXOSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updateUTXO()
+	return c.utxo
+}
+
+// updateUTXO applies any blocks not yet reflected in the chain's UTXO set.
+// The caller must hold the chain's lock.
+func (c *Blockchain) updateUTXO() {
+	e := c.l.Back()
+	for i := c.l.Len() - 1; i > c.utxo.applied; i-- {
+		e = e.Prev()
+	}
+	for ; e != nil && c.utxo.applied < c.l.Len(); e = e.Next() {
+		c.utxo.apply(e.Value.(*Block))
+	}
+}
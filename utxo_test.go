@@ -0,0 +1,47 @@
+package blockchain_test
+
+import (
+	"testing"
+
+	blockchain "github.com/dradtke/go-blockchain"
+)
+
+func TestUTXOBalance(t *testing.T) {
+	const difficulty = 1
+
+	chain := blockchain.New(difficulty)
+	alice, bob := mustIdentity(blockchain.NewIdentity()), mustIdentity(blockchain.NewIdentity())
+	miner := mustIdentity(blockchain.NewIdentity())
+	identities := []blockchain.Identity{alice, bob, miner}
+
+	var prevHash []byte
+	for i, fee := range []uint64{0, 1, 5} {
+		block := blockchain.NewBlockForMiner(prevHash, miner.PublicKey(), nil)
+		for j, from := range []blockchain.Identity{alice, bob} {
+			to := identities[(j+1)%2]
+			tx, err := blockchain.NewFeeTransaction(from, to.PublicKey(), uint64(10*(i+1)), fee, nil)
+			if err != nil {
+				t.Fatalf("failed to create transaction: %s", err)
+			}
+			if err := block.AddTransaction(tx); err != nil {
+				t.Fatalf("failed to add transaction: %s", err)
+			}
+		}
+		block.Mine(difficulty)
+		prevHash = block.Hash()
+		if err := chain.AppendBlock(block); err != nil {
+			t.Fatalf("failed to append block %d: %s", i, err)
+		}
+	}
+
+	block := chain.NewBlock()
+	sendValue(t, block, alice, miner, 7)
+	block.Mine(difficulty)
+
+	utxo := chain.UTXO()
+	for i, identity := range identities {
+		if got, want := utxo.Balance(identity.PublicKey()), chain.Balance(identity.PublicKey()); got != want {
+			t.Errorf("identity %d: UTXO balance = %d, want %d", i, got, want)
+		}
+	}
+}